@@ -4,7 +4,9 @@ import (
 	"flag"
 	"fmt"
 	"log"
+	"log/slog"
 	"net/http"
+	"os"
 
 	"github.com/tanq16/expenseowl/internal/api"
 	"github.com/tanq16/expenseowl/internal/storage"
@@ -31,6 +33,11 @@ func runServer(port int) {
 		w.Write([]byte(version))
 	})
 
+	// Health and Metrics Handlers
+	http.HandleFunc("/healthz", handler.Healthz)
+	http.HandleFunc("/openapi.json", handler.OpenAPISpec)
+	http.HandleFunc("/metrics", handler.Metrics)
+
 	// UI Handlers
 	http.HandleFunc("/", func(w http.ResponseWriter, r *http.Request) {
 		if r.URL.Path != "/" {
@@ -39,7 +46,7 @@ func runServer(port int) {
 		}
 		w.Header().Set("Content-Type", "text/html")
 		if err := web.ServeTemplate(w, "index.html"); err != nil {
-			log.Printf("HTTP ERROR: Failed to serve template: %v", err)
+			slog.ErrorContext(r.Context(), "Failed to serve template", "request_id", api.RequestID(r.Context()), "error", err)
 			http.Error(w, "Failed to serve template", http.StatusInternalServerError)
 			return
 		}
@@ -61,34 +68,70 @@ func runServer(port int) {
 	// Config
 	http.HandleFunc("/config", handler.GetConfig)
 	http.HandleFunc("/categories", handler.GetCategories)
+	http.HandleFunc("/categories/used", handler.GetUsedCategories)
 	http.HandleFunc("/categories/edit", handler.UpdateCategories)
+	http.HandleFunc("/categories/add", handler.AddCategory)
+	http.HandleFunc("/categories/remove", handler.RemoveCategory)
+	http.HandleFunc("/categories/validate", handler.ValidateCategories)
+	http.HandleFunc("/categories/rename", handler.RenameCategory)
+	http.HandleFunc("/categories/merge", handler.MergeCategories)
+	http.HandleFunc("/categories/colors", handler.GetCategoryColors)
+	http.HandleFunc("/categories/colors/edit", handler.UpdateCategoryColors)
+	http.HandleFunc("/categories/strict/edit", handler.UpdateStrictCategories)
 	http.HandleFunc("/currency", handler.GetCurrency)
 	http.HandleFunc("/currency/edit", handler.UpdateCurrency)
+	http.HandleFunc("/supported", handler.GetSupported)
 	http.HandleFunc("/startdate", handler.GetStartDate)
 	http.HandleFunc("/startdate/edit", handler.UpdateStartDate)
+	http.HandleFunc("/symbolposition/edit", handler.UpdateSymbolPosition)
+	http.HandleFunc("/grouping/edit", handler.UpdateUngroupedCurrencies) // PUT currency codes shown without grouping
+	http.HandleFunc("/numberlocale/edit", handler.UpdateNumberLocale)    // PUT a locale tag like "ms-MY", or "" for the currency's
+	http.HandleFunc("/separators/edit", handler.UpdateSeparators)        // PUT {"thousands", "decimal"}, both "" for the locale's
+	http.HandleFunc("/holidays/edit", handler.UpdateHolidays)            // PUT a list of YYYY-MM-DD dates
 	// http.HandleFunc("/tags", handler.GetTags)
 	// http.HandleFunc("/tags/edit", handler.UpdateTags)
 
 	// Expenses
 	http.HandleFunc("/expense", handler.AddExpense)                     // PUT for add
 	http.HandleFunc("/expenses", handler.GetExpenses)                   // GET all
+	http.HandleFunc("/expense/get", handler.GetExpenseByID)             // GET single by ID
+	http.HandleFunc("/expenses/get", handler.GetExpensesByIDs)          // POST for multiple by IDs
 	http.HandleFunc("/expense/edit", handler.EditExpense)               // PUT for edit
+	http.HandleFunc("/expense/patch", handler.PatchExpense)             // PATCH for partial edit
+	http.HandleFunc("/expense/duplicate", handler.DuplicateExpense)     // POST to copy by ID
 	http.HandleFunc("/expense/delete", handler.DeleteExpense)           // DELETE for single
 	http.HandleFunc("/expenses/delete", handler.DeleteMultipleExpenses) // DELETE for multiple
 
 	// Recurring Expenses
-	http.HandleFunc("/recurring-expense", handler.AddRecurringExpense)           // PUT for add
-	http.HandleFunc("/recurring-expenses", handler.GetRecurringExpenses)         // GET all
-	http.HandleFunc("/recurring-expense/edit", handler.UpdateRecurringExpense)   // PUT for edit
-	http.HandleFunc("/recurring-expense/delete", handler.DeleteRecurringExpense) // DELETE
+	http.HandleFunc("/recurring-expense", handler.AddRecurringExpense)                // PUT for add
+	http.HandleFunc("/recurring-expenses", handler.GetRecurringExpenses)              // GET all
+	http.HandleFunc("/recurring-expenses/next", handler.GetRecurringWithNext)         // GET all with next occurrence
+	http.HandleFunc("/recurring-expense/instances", handler.GetRecurringInstances)    // GET generated expenses by rule ID
+	http.HandleFunc("/recurring-expense/edit", handler.UpdateRecurringExpense)        // PUT for edit
+	http.HandleFunc("/recurring-expense/delete", handler.DeleteRecurringExpense)      // DELETE
+	http.HandleFunc("/recurring-expenses/regenerate", handler.RegenerateAllRecurring) // POST to refresh future instances
+
+	// Reports
+	http.HandleFunc("/breakdown/yearly", handler.GetYearlyBreakdown) // GET monthly totals, ?year=
+
+	// Audit Log
+	http.HandleFunc("/audit", handler.GetAuditLog) // GET newest first, ?limit=&offset=
 
 	// Import/Export
 	http.HandleFunc("/export/csv", handler.ExportCSV)
+	http.HandleFunc("/export/ndjson", handler.StreamExpensesNDJSON) // GET one JSON expense per line, streamed
 	http.HandleFunc("/import/csv", handler.ImportCSV)
 	http.HandleFunc("/import/csvold", handler.ImportOldCSV)
 
+	if webhookURL := os.Getenv("WEBHOOK_URL"); webhookURL != "" {
+		webhook := api.NewWebhook(webhookURL, os.Getenv("WEBHOOK_SECRET"), storage)
+		webhook.Start(api.WebhookIntervalFromEnv(os.Getenv("WEBHOOK_INTERVAL")))
+	}
+
 	log.Println("Starting server on port", port, "...")
-	if err := http.ListenAndServe(fmt.Sprint(":", port), nil); err != nil {
+	corsOrigins := api.CORSOriginsFromEnv(os.Getenv("CORS_ORIGINS"))
+	server := api.WithRequestLogging(handler.WithMetrics(api.WithCORS(http.DefaultServeMux, corsOrigins)))
+	if err := http.ListenAndServe(fmt.Sprint(":", port), server); err != nil {
 		log.Fatalf("Server failed to start: %v", err)
 	}
 }
@@ -96,5 +139,6 @@ func runServer(port int) {
 func main() {
 	port := flag.Int("port", 8080, "Port to serve from")
 	flag.Parse()
+	slog.SetDefault(slog.New(slog.NewTextHandler(os.Stdout, nil)))
 	runServer(*port)
 }
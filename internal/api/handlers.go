@@ -2,12 +2,15 @@ package api
 
 import (
 	"encoding/json"
+	"errors"
 	"fmt"
-	"log"
+	"io"
 	"net/http"
+	"slices"
 	"strconv"
 	"time"
 
+	"github.com/google/uuid"
 	"github.com/tanq16/expenseowl/internal/storage"
 	"github.com/tanq16/expenseowl/internal/web"
 )
@@ -15,12 +18,17 @@ import (
 // Handler holds the storage interface
 type Handler struct {
 	storage storage.Storage
+	metrics *appMetrics
 }
 
-// NewHandler creates a new API handler
+// NewHandler creates a new API handler, timing its storage calls for /metrics
 func NewHandler(s storage.Storage) *Handler {
+	metrics := newAppMetrics()
+	s = storage.WithQueryTimer(s, metrics.observeQuery)
+	metrics.registry.MustRegister(countsCollector{storage: s})
 	return &Handler{
 		storage: s,
+		metrics: metrics,
 	}
 }
 
@@ -38,6 +46,39 @@ func writeJSON(w http.ResponseWriter, status int, v any) {
 	}
 }
 
+// parses an optional boolean query value, where empty means false
+func parseOptionalBool(value string) (bool, error) {
+	if value == "" {
+		return false, nil
+	}
+	return strconv.ParseBool(value)
+}
+
+// ------------------------------------------------------------
+// Health Handler
+// ------------------------------------------------------------
+
+// HealthResponse reports the storage backend in use
+type HealthResponse struct {
+	Status string `json:"status"`
+	storage.StorageStatus
+	Error string `json:"error,omitempty"`
+}
+
+func (h *Handler) Healthz(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		writeJSON(w, http.StatusMethodNotAllowed, ErrorResponse{Error: "Method not allowed"})
+		return
+	}
+	status, err := h.storage.Status()
+	if err != nil {
+		writeJSON(w, http.StatusServiceUnavailable, HealthResponse{Status: "unavailable", StorageStatus: status, Error: err.Error()})
+		logAPIError(r, "Health check failed", err)
+		return
+	}
+	writeJSON(w, http.StatusOK, HealthResponse{Status: "ok", StorageStatus: status})
+}
+
 // ------------------------------------------------------------
 // Config Handlers
 // ------------------------------------------------------------
@@ -50,7 +91,7 @@ func (h *Handler) GetConfig(w http.ResponseWriter, r *http.Request) {
 	config, err := h.storage.GetConfig()
 	if err != nil {
 		writeJSON(w, http.StatusInternalServerError, ErrorResponse{Error: "Failed to get config"})
-		log.Printf("API ERROR: Failed to get config: %v\n", err)
+		logAPIError(r, "Failed to get config", err)
 		return
 	}
 	writeJSON(w, http.StatusOK, config)
@@ -64,7 +105,7 @@ func (h *Handler) GetCategories(w http.ResponseWriter, r *http.Request) {
 	categories, err := h.storage.GetCategories()
 	if err != nil {
 		writeJSON(w, http.StatusInternalServerError, ErrorResponse{Error: "Failed to get categories"})
-		log.Printf("API ERROR: Failed to get categories: %v\n", err)
+		logAPIError(r, "Failed to get categories", err)
 		return
 	}
 	writeJSON(w, http.StatusOK, categories)
@@ -84,7 +125,7 @@ func (h *Handler) UpdateCategories(w http.ResponseWriter, r *http.Request) {
 	for _, category := range categories {
 		sanitized, err := storage.ValidateCategory(category)
 		if err != nil {
-			log.Printf("API ERROR: Invalid category provided: %v\n", err)
+			logAPIError(r, "Invalid category provided", err)
 			writeJSON(w, http.StatusBadRequest, ErrorResponse{Error: fmt.Sprintf("Invalid category '%s': %v", category, err)})
 			return
 		}
@@ -92,7 +133,220 @@ func (h *Handler) UpdateCategories(w http.ResponseWriter, r *http.Request) {
 	}
 	if err := h.storage.UpdateCategories(sanitizedCategories); err != nil {
 		writeJSON(w, http.StatusInternalServerError, ErrorResponse{Error: "Failed to update categories"})
-		log.Printf("API ERROR: Failed to update categories: %v\n", err)
+		logAPIError(r, "Failed to update categories", err)
+		return
+	}
+	writeJSON(w, http.StatusOK, map[string]string{"status": "success"})
+}
+
+// adds a single category (JSON string body), leaving the rest of the list untouched
+func (h *Handler) AddCategory(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPut {
+		writeJSON(w, http.StatusMethodNotAllowed, ErrorResponse{Error: "Method not allowed"})
+		return
+	}
+	var name string
+	if err := json.NewDecoder(r.Body).Decode(&name); err != nil {
+		writeJSON(w, http.StatusBadRequest, ErrorResponse{Error: "Invalid request body"})
+		return
+	}
+	if _, err := storage.ValidateCategory(name); err != nil {
+		writeJSON(w, http.StatusBadRequest, ErrorResponse{Error: fmt.Sprintf("Invalid category '%s': %v", name, err)})
+		return
+	}
+	if err := h.storage.AddCategory(name); err != nil {
+		writeJSON(w, http.StatusInternalServerError, ErrorResponse{Error: "Failed to add category"})
+		logAPIError(r, "Failed to add category", err)
+		return
+	}
+	writeJSON(w, http.StatusOK, map[string]string{"status": "success"})
+}
+
+func (h *Handler) RemoveCategory(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodDelete {
+		writeJSON(w, http.StatusMethodNotAllowed, ErrorResponse{Error: "Method not allowed"})
+		return
+	}
+	name := r.URL.Query().Get("name")
+	if name == "" {
+		writeJSON(w, http.StatusBadRequest, ErrorResponse{Error: "Name parameter is required"})
+		return
+	}
+	if err := h.storage.RemoveCategory(name); err != nil {
+		writeJSON(w, http.StatusInternalServerError, ErrorResponse{Error: "Failed to remove category"})
+		logAPIError(r, "Failed to remove category", err)
+		return
+	}
+	writeJSON(w, http.StatusOK, map[string]string{"status": "success"})
+}
+
+func (h *Handler) GetCategoryColors(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		writeJSON(w, http.StatusMethodNotAllowed, ErrorResponse{Error: "Method not allowed"})
+		return
+	}
+	colors, err := h.storage.GetCategoryColors()
+	if err != nil {
+		writeJSON(w, http.StatusInternalServerError, ErrorResponse{Error: "Failed to get category colors"})
+		logAPIError(r, "Failed to get category colors", err)
+		return
+	}
+	writeJSON(w, http.StatusOK, colors)
+}
+
+func (h *Handler) UpdateCategoryColors(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPut {
+		writeJSON(w, http.StatusMethodNotAllowed, ErrorResponse{Error: "Method not allowed"})
+		return
+	}
+	var colors map[string]string
+	if err := json.NewDecoder(r.Body).Decode(&colors); err != nil {
+		writeJSON(w, http.StatusBadRequest, ErrorResponse{Error: "Invalid request body"})
+		return
+	}
+	if err := h.storage.UpdateCategoryColors(colors); err != nil {
+		writeJSON(w, http.StatusInternalServerError, ErrorResponse{Error: err.Error()})
+		logAPIError(r, "Failed to update category colors", err)
+		return
+	}
+	writeJSON(w, http.StatusOK, map[string]string{"status": "success"})
+}
+
+// UsedCategories lists the categories found on stored expenses
+type UsedCategories struct {
+	Categories   []string `json:"categories"`
+	Unconfigured []string `json:"unconfigured"` // used but missing from the configured list
+}
+
+func (h *Handler) GetUsedCategories(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		writeJSON(w, http.StatusMethodNotAllowed, ErrorResponse{Error: "Method not allowed"})
+		return
+	}
+	used, err := h.storage.GetUsedCategories()
+	if err != nil {
+		writeJSON(w, http.StatusInternalServerError, ErrorResponse{Error: "Failed to get used categories"})
+		logAPIError(r, "Failed to get used categories", err)
+		return
+	}
+	configured, err := h.storage.GetCategories()
+	if err != nil {
+		writeJSON(w, http.StatusInternalServerError, ErrorResponse{Error: "Failed to get categories"})
+		logAPIError(r, "Failed to get categories", err)
+		return
+	}
+	result := UsedCategories{Categories: used, Unconfigured: []string{}}
+	for _, category := range used {
+		if !slices.Contains(configured, category) {
+			result.Unconfigured = append(result.Unconfigured, category)
+		}
+	}
+	writeJSON(w, http.StatusOK, result)
+}
+
+// CategoryValidation is the outcome of validating one category name
+type CategoryValidation struct {
+	Input     string `json:"input"`
+	Sanitized string `json:"sanitized"`
+	Valid     bool   `json:"valid"`
+	Error     string `json:"error,omitempty"`
+	Changed   bool   `json:"changed"`   // sanitizing altered the input
+	Exists    bool   `json:"exists"`    // already a configured category
+	Duplicate bool   `json:"duplicate"` // sanitizes to the same name as an earlier input
+}
+
+// validates a batch of category names without saving them
+func (h *Handler) ValidateCategories(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		writeJSON(w, http.StatusMethodNotAllowed, ErrorResponse{Error: "Method not allowed"})
+		return
+	}
+	var categories []string
+	if err := json.NewDecoder(r.Body).Decode(&categories); err != nil {
+		writeJSON(w, http.StatusBadRequest, ErrorResponse{Error: "Invalid request body"})
+		return
+	}
+	existing, err := h.storage.GetCategories()
+	if err != nil {
+		writeJSON(w, http.StatusInternalServerError, ErrorResponse{Error: "Failed to get categories"})
+		logAPIError(r, "Failed to get categories", err)
+		return
+	}
+	results := make([]CategoryValidation, 0, len(categories))
+	seen := make(map[string]bool)
+	for _, category := range categories {
+		result := CategoryValidation{Input: category}
+		sanitized, err := storage.ValidateCategory(category)
+		if err != nil {
+			result.Error = err.Error()
+			results = append(results, result)
+			continue
+		}
+		result.Sanitized = sanitized
+		result.Valid = true
+		result.Changed = sanitized != category
+		result.Exists = slices.Contains(existing, sanitized)
+		result.Duplicate = seen[sanitized]
+		seen[sanitized] = true
+		results = append(results, result)
+	}
+	writeJSON(w, http.StatusOK, results)
+}
+
+// maps storage errors caused by the request to client error statuses
+func errorStatus(err error) int {
+	switch {
+	case errors.Is(err, storage.ErrNotFound):
+		return http.StatusNotFound
+	case errors.Is(err, storage.ErrInvalid):
+		return http.StatusBadRequest
+	}
+	return http.StatusInternalServerError
+}
+
+// RenameCategoryRequest is the body of /categories/rename
+type RenameCategoryRequest struct {
+	Old string `json:"old"`
+	New string `json:"new"`
+}
+
+func (h *Handler) RenameCategory(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPut {
+		writeJSON(w, http.StatusMethodNotAllowed, ErrorResponse{Error: "Method not allowed"})
+		return
+	}
+	var payload RenameCategoryRequest
+	if err := json.NewDecoder(r.Body).Decode(&payload); err != nil {
+		writeJSON(w, http.StatusBadRequest, ErrorResponse{Error: "Invalid request body"})
+		return
+	}
+	if err := h.storage.RenameCategory(payload.Old, payload.New); err != nil {
+		writeJSON(w, errorStatus(err), ErrorResponse{Error: err.Error()})
+		logAPIError(r, "Failed to rename category", err)
+		return
+	}
+	writeJSON(w, http.StatusOK, map[string]string{"status": "success"})
+}
+
+// MergeCategoriesRequest is the body of /categories/merge
+type MergeCategoriesRequest struct {
+	Sources []string `json:"sources"`
+	Target  string   `json:"target"`
+}
+
+func (h *Handler) MergeCategories(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPut {
+		writeJSON(w, http.StatusMethodNotAllowed, ErrorResponse{Error: "Method not allowed"})
+		return
+	}
+	var payload MergeCategoriesRequest
+	if err := json.NewDecoder(r.Body).Decode(&payload); err != nil {
+		writeJSON(w, http.StatusBadRequest, ErrorResponse{Error: "Invalid request body"})
+		return
+	}
+	if err := h.storage.MergeCategories(payload.Sources, payload.Target); err != nil {
+		writeJSON(w, errorStatus(err), ErrorResponse{Error: err.Error()})
+		logAPIError(r, "Failed to merge categories", err)
 		return
 	}
 	writeJSON(w, http.StatusOK, map[string]string{"status": "success"})
@@ -106,7 +360,7 @@ func (h *Handler) GetCurrency(w http.ResponseWriter, r *http.Request) {
 	currency, err := h.storage.GetCurrency()
 	if err != nil {
 		writeJSON(w, http.StatusInternalServerError, ErrorResponse{Error: "Failed to get currency"})
-		log.Printf("API ERROR: Failed to get currency: %v\n", err)
+		logAPIError(r, "Failed to get currency", err)
 		return
 	}
 	writeJSON(w, http.StatusOK, currency)
@@ -124,12 +378,36 @@ func (h *Handler) UpdateCurrency(w http.ResponseWriter, r *http.Request) {
 	}
 	if err := h.storage.UpdateCurrency(currency); err != nil {
 		writeJSON(w, http.StatusInternalServerError, ErrorResponse{Error: err.Error()})
-		log.Printf("API ERROR: Failed to update currency: %v\n", err)
+		logAPIError(r, "Failed to update currency", err)
 		return
 	}
 	writeJSON(w, http.StatusOK, map[string]string{"status": "success"})
 }
 
+// SupportedCurrency describes a currency the backend accepts
+type SupportedCurrency struct {
+	Code string `json:"code"`
+	Name string `json:"name"`
+}
+
+// SupportedResponse lists the values the backend accepts
+type SupportedResponse struct {
+	Currencies []SupportedCurrency `json:"currencies"`
+}
+
+// lists the values the backend accepts so the UI doesn't drift from it
+func (h *Handler) GetSupported(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		writeJSON(w, http.StatusMethodNotAllowed, ErrorResponse{Error: "Method not allowed"})
+		return
+	}
+	currencies := make([]SupportedCurrency, 0, len(storage.SupportedCurrencies))
+	for _, code := range storage.SupportedCurrencies {
+		currencies = append(currencies, SupportedCurrency{Code: code, Name: storage.CurrencyName(code)})
+	}
+	writeJSON(w, http.StatusOK, SupportedResponse{Currencies: currencies})
+}
+
 func (h *Handler) GetStartDate(w http.ResponseWriter, r *http.Request) {
 	if r.Method != http.MethodGet {
 		writeJSON(w, http.StatusMethodNotAllowed, ErrorResponse{Error: "Method not allowed"})
@@ -138,7 +416,7 @@ func (h *Handler) GetStartDate(w http.ResponseWriter, r *http.Request) {
 	startDate, err := h.storage.GetStartDate()
 	if err != nil {
 		writeJSON(w, http.StatusInternalServerError, ErrorResponse{Error: "Failed to get start date"})
-		log.Printf("API ERROR: Failed to get start date: %v\n", err)
+		logAPIError(r, "Failed to get start date", err)
 		return
 	}
 	writeJSON(w, http.StatusOK, startDate)
@@ -156,7 +434,129 @@ func (h *Handler) UpdateStartDate(w http.ResponseWriter, r *http.Request) {
 	}
 	if err := h.storage.UpdateStartDate(startDate); err != nil {
 		writeJSON(w, http.StatusInternalServerError, ErrorResponse{Error: err.Error()})
-		log.Printf("API ERROR: Failed to update start date: %v\n", err)
+		logAPIError(r, "Failed to update start date", err)
+		return
+	}
+	writeJSON(w, http.StatusOK, map[string]string{"status": "success"})
+}
+
+func (h *Handler) UpdateSymbolPosition(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPut {
+		writeJSON(w, http.StatusMethodNotAllowed, ErrorResponse{Error: "Method not allowed"})
+		return
+	}
+	var position string
+	if err := json.NewDecoder(r.Body).Decode(&position); err != nil {
+		writeJSON(w, http.StatusBadRequest, ErrorResponse{Error: "Invalid request body"})
+		return
+	}
+	if err := h.storage.UpdateSymbolPosition(position); err != nil {
+		writeJSON(w, http.StatusInternalServerError, ErrorResponse{Error: err.Error()})
+		logAPIError(r, "Failed to update symbol position", err)
+		return
+	}
+	writeJSON(w, http.StatusOK, map[string]string{"status": "success"})
+}
+
+// turns rejecting expenses in unconfigured categories on or off
+func (h *Handler) UpdateStrictCategories(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPut {
+		writeJSON(w, http.StatusMethodNotAllowed, ErrorResponse{Error: "Method not allowed"})
+		return
+	}
+	var strict bool
+	if err := json.NewDecoder(r.Body).Decode(&strict); err != nil {
+		writeJSON(w, http.StatusBadRequest, ErrorResponse{Error: "Invalid request body"})
+		return
+	}
+	if err := h.storage.UpdateStrictCategories(strict); err != nil {
+		writeJSON(w, http.StatusInternalServerError, ErrorResponse{Error: err.Error()})
+		logAPIError(r, "Failed to update strict categories", err)
+		return
+	}
+	writeJSON(w, http.StatusOK, map[string]string{"status": "success"})
+}
+
+// replaces the currencies whose amounts are shown without thousands grouping
+func (h *Handler) UpdateUngroupedCurrencies(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPut {
+		writeJSON(w, http.StatusMethodNotAllowed, ErrorResponse{Error: "Method not allowed"})
+		return
+	}
+	var currencies []string
+	if err := json.NewDecoder(r.Body).Decode(&currencies); err != nil {
+		writeJSON(w, http.StatusBadRequest, ErrorResponse{Error: "Invalid request body"})
+		return
+	}
+	if err := h.storage.UpdateUngroupedCurrencies(currencies); err != nil {
+		writeJSON(w, http.StatusInternalServerError, ErrorResponse{Error: err.Error()})
+		logAPIError(r, "Failed to update ungrouped currencies", err)
+		return
+	}
+	writeJSON(w, http.StatusOK, map[string]string{"status": "success"})
+}
+
+// sets the locale used for digit grouping and decimal marks, independently of
+// the currency symbol; an empty string goes back to the currency's own style
+func (h *Handler) UpdateNumberLocale(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPut {
+		writeJSON(w, http.StatusMethodNotAllowed, ErrorResponse{Error: "Method not allowed"})
+		return
+	}
+	var locale string
+	if err := json.NewDecoder(r.Body).Decode(&locale); err != nil {
+		writeJSON(w, http.StatusBadRequest, ErrorResponse{Error: "Invalid request body"})
+		return
+	}
+	if err := h.storage.UpdateNumberLocale(locale); err != nil {
+		writeJSON(w, http.StatusInternalServerError, ErrorResponse{Error: err.Error()})
+		logAPIError(r, "Failed to update number locale", err)
+		return
+	}
+	writeJSON(w, http.StatusOK, map[string]string{"status": "success"})
+}
+
+// SeparatorsRequest is the body of /separators/edit
+type SeparatorsRequest struct {
+	Thousands string `json:"thousands"`
+	Decimal   string `json:"decimal"`
+}
+
+// sets the thousands and decimal separators, which take precedence over the
+// number locale and the currency; both empty goes back to those
+func (h *Handler) UpdateSeparators(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPut {
+		writeJSON(w, http.StatusMethodNotAllowed, ErrorResponse{Error: "Method not allowed"})
+		return
+	}
+	var payload SeparatorsRequest
+	if err := json.NewDecoder(r.Body).Decode(&payload); err != nil {
+		writeJSON(w, http.StatusBadRequest, ErrorResponse{Error: "Invalid request body"})
+		return
+	}
+	if err := h.storage.UpdateSeparators(payload.Thousands, payload.Decimal); err != nil {
+		writeJSON(w, errorStatus(err), ErrorResponse{Error: err.Error()})
+		logAPIError(r, "Failed to update separators", err)
+		return
+	}
+	writeJSON(w, http.StatusOK, map[string]string{"status": "success"})
+}
+
+// replaces the holidays skipped by recurring rules that opt in; existing
+// instances are only affected once their rule is edited or regenerated
+func (h *Handler) UpdateHolidays(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPut {
+		writeJSON(w, http.StatusMethodNotAllowed, ErrorResponse{Error: "Method not allowed"})
+		return
+	}
+	var holidays []string
+	if err := json.NewDecoder(r.Body).Decode(&holidays); err != nil {
+		writeJSON(w, http.StatusBadRequest, ErrorResponse{Error: "Invalid request body"})
+		return
+	}
+	if err := h.storage.UpdateHolidays(holidays); err != nil {
+		writeJSON(w, http.StatusInternalServerError, ErrorResponse{Error: err.Error()})
+		logAPIError(r, "Failed to update holidays", err)
 		return
 	}
 	writeJSON(w, http.StatusOK, map[string]string{"status": "success"})
@@ -184,8 +584,61 @@ func (h *Handler) AddExpense(w http.ResponseWriter, r *http.Request) {
 		expense.Date = time.Now()
 	}
 	if err := h.storage.AddExpense(expense); err != nil {
+		if errors.Is(err, storage.ErrInvalid) {
+			writeJSON(w, http.StatusBadRequest, ErrorResponse{Error: err.Error()})
+			return
+		}
+		writeJSON(w, http.StatusInternalServerError, ErrorResponse{Error: "Failed to save expense"})
+		logAPIError(r, "Failed to save expense", err)
+		return
+	}
+	writeJSON(w, http.StatusOK, expense)
+}
+
+// copies an expense to a new ID dated now, or at the optional {"date"} in the body
+func (h *Handler) DuplicateExpense(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		writeJSON(w, http.StatusMethodNotAllowed, ErrorResponse{Error: "Method not allowed"})
+		return
+	}
+	id := r.URL.Query().Get("id")
+	if id == "" {
+		writeJSON(w, http.StatusBadRequest, ErrorResponse{Error: "ID parameter is required"})
+		return
+	}
+	var payload struct {
+		Date time.Time `json:"date"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&payload); err != nil && err != io.EOF {
+		writeJSON(w, http.StatusBadRequest, ErrorResponse{Error: "Invalid request body"})
+		return
+	}
+	expense, err := h.storage.GetExpense(id)
+	if errors.Is(err, storage.ErrNotFound) {
+		writeJSON(w, http.StatusNotFound, ErrorResponse{Error: "Expense not found"})
+		return
+	}
+	if err != nil {
+		writeJSON(w, http.StatusInternalServerError, ErrorResponse{Error: "Failed to retrieve expense"})
+		logAPIError(r, "Failed to retrieve expense", err)
+		return
+	}
+	// the ID is set here rather than by the store so the copy can be returned,
+	// and the copy is detached from any recurring rule so regenerating it won't remove it
+	expense.ID = uuid.New().String()
+	expense.RecurringID = ""
+	expense.Date = payload.Date
+	if expense.Date.IsZero() {
+		expense.Date = time.Now()
+	}
+	if err := h.storage.AddExpense(expense); err != nil {
+		// the original may predate strict categories or a category's removal
+		if errors.Is(err, storage.ErrInvalid) {
+			writeJSON(w, http.StatusBadRequest, ErrorResponse{Error: err.Error()})
+			return
+		}
 		writeJSON(w, http.StatusInternalServerError, ErrorResponse{Error: "Failed to save expense"})
-		log.Printf("API ERROR: Failed to save expense: %v\n", err)
+		logAPIError(r, "Failed to save duplicated expense", err)
 		return
 	}
 	writeJSON(w, http.StatusOK, expense)
@@ -199,12 +652,75 @@ func (h *Handler) GetExpenses(w http.ResponseWriter, r *http.Request) {
 	expenses, err := h.storage.GetAllExpenses()
 	if err != nil {
 		writeJSON(w, http.StatusInternalServerError, ErrorResponse{Error: "Failed to retrieve expenses"})
-		log.Printf("API ERROR: Failed to retrieve expenses: %v\n", err)
+		logAPIError(r, "Failed to retrieve expenses", err)
 		return
 	}
 	writeJSON(w, http.StatusOK, expenses)
 }
 
+func (h *Handler) GetExpenseByID(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		writeJSON(w, http.StatusMethodNotAllowed, ErrorResponse{Error: "Method not allowed"})
+		return
+	}
+	id := r.URL.Query().Get("id")
+	if id == "" {
+		writeJSON(w, http.StatusBadRequest, ErrorResponse{Error: "ID parameter is required"})
+		return
+	}
+	expense, err := h.storage.GetExpense(id)
+	if errors.Is(err, storage.ErrNotFound) {
+		writeJSON(w, http.StatusNotFound, ErrorResponse{Error: "Expense not found"})
+		return
+	}
+	if err != nil {
+		writeJSON(w, http.StatusInternalServerError, ErrorResponse{Error: "Failed to retrieve expense"})
+		logAPIError(r, "Failed to retrieve expense", err)
+		return
+	}
+	writeJSON(w, http.StatusOK, expense)
+}
+
+// ExpenseIDsRequest is the body of the endpoints taking a list of expense IDs
+type ExpenseIDsRequest struct {
+	IDs []string `json:"ids"`
+}
+
+// ExpensesByIDsResponse holds the expenses found for a batch lookup
+type ExpensesByIDsResponse struct {
+	Expenses []storage.Expense `json:"expenses"`
+	Missing  []string          `json:"missing"`
+}
+
+func (h *Handler) GetExpensesByIDs(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		writeJSON(w, http.StatusMethodNotAllowed, ErrorResponse{Error: "Method not allowed"})
+		return
+	}
+	var payload ExpenseIDsRequest
+	if err := json.NewDecoder(r.Body).Decode(&payload); err != nil {
+		writeJSON(w, http.StatusBadRequest, ErrorResponse{Error: "Invalid request body"})
+		return
+	}
+	expenses, err := h.storage.GetExpensesByIDs(payload.IDs)
+	if err != nil {
+		writeJSON(w, http.StatusInternalServerError, ErrorResponse{Error: "Failed to retrieve expenses"})
+		logAPIError(r, "Failed to retrieve expenses by IDs", err)
+		return
+	}
+	found := make(map[string]bool, len(expenses))
+	for _, exp := range expenses {
+		found[exp.ID] = true
+	}
+	missing := []string{}
+	for _, id := range payload.IDs {
+		if !found[id] && !slices.Contains(missing, id) {
+			missing = append(missing, id)
+		}
+	}
+	writeJSON(w, http.StatusOK, ExpensesByIDsResponse{Expenses: expenses, Missing: missing})
+}
+
 func (h *Handler) EditExpense(w http.ResponseWriter, r *http.Request) {
 	if r.Method != http.MethodPut {
 		writeJSON(w, http.StatusMethodNotAllowed, ErrorResponse{Error: "Method not allowed"})
@@ -225,8 +741,64 @@ func (h *Handler) EditExpense(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 	if err := h.storage.UpdateExpense(id, expense); err != nil {
+		if errors.Is(err, storage.ErrInvalid) {
+			writeJSON(w, http.StatusBadRequest, ErrorResponse{Error: err.Error()})
+			return
+		}
 		writeJSON(w, http.StatusInternalServerError, ErrorResponse{Error: "Failed to edit expense"})
-		log.Printf("API ERROR: Failed to edit expense: %v\n", err)
+		logAPIError(r, "Failed to edit expense", err)
+		return
+	}
+	writeJSON(w, http.StatusOK, expense)
+}
+
+// applies the fields present in the body on top of the stored expense; fields
+// that are left out or sent as null keep their value, while fields sent as
+// zero or empty are cleared
+func (h *Handler) PatchExpense(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPatch {
+		writeJSON(w, http.StatusMethodNotAllowed, ErrorResponse{Error: "Method not allowed"})
+		return
+	}
+	id := r.URL.Query().Get("id")
+	if id == "" {
+		writeJSON(w, http.StatusBadRequest, ErrorResponse{Error: "ID parameter is required"})
+		return
+	}
+	body, err := io.ReadAll(r.Body)
+	if err != nil {
+		writeJSON(w, http.StatusBadRequest, ErrorResponse{Error: "Invalid request body"})
+		return
+	}
+	var invalid error
+	expense, err := h.storage.PatchExpense(id, func(expense *storage.Expense) error {
+		// unmarshaling onto the stored expense only touches the keys in the body
+		if err := json.Unmarshal(body, expense); err != nil {
+			invalid = errors.New("Invalid request body")
+			return invalid
+		}
+		expense.ID = id
+		if err := expense.Validate(); err != nil {
+			invalid = err
+			return err
+		}
+		return nil
+	})
+	if invalid != nil {
+		writeJSON(w, http.StatusBadRequest, ErrorResponse{Error: invalid.Error()})
+		return
+	}
+	if errors.Is(err, storage.ErrInvalid) {
+		writeJSON(w, http.StatusBadRequest, ErrorResponse{Error: err.Error()})
+		return
+	}
+	if errors.Is(err, storage.ErrNotFound) {
+		writeJSON(w, http.StatusNotFound, ErrorResponse{Error: "Expense not found"})
+		return
+	}
+	if err != nil {
+		writeJSON(w, http.StatusInternalServerError, ErrorResponse{Error: "Failed to edit expense"})
+		logAPIError(r, "Failed to patch expense", err)
 		return
 	}
 	writeJSON(w, http.StatusOK, expense)
@@ -244,7 +816,7 @@ func (h *Handler) DeleteExpense(w http.ResponseWriter, r *http.Request) {
 	}
 	if err := h.storage.RemoveExpense(id); err != nil {
 		writeJSON(w, http.StatusInternalServerError, ErrorResponse{Error: "Failed to delete expense"})
-		log.Printf("API ERROR: Failed to delete expense: %v\n", err)
+		logAPIError(r, "Failed to delete expense", err)
 		return
 	}
 	writeJSON(w, http.StatusOK, map[string]string{"status": "success"})
@@ -255,16 +827,14 @@ func (h *Handler) DeleteMultipleExpenses(w http.ResponseWriter, r *http.Request)
 		writeJSON(w, http.StatusMethodNotAllowed, ErrorResponse{Error: "Method not allowed"})
 		return
 	}
-	var payload struct {
-		IDs []string `json:"ids"`
-	}
+	var payload ExpenseIDsRequest
 	if err := json.NewDecoder(r.Body).Decode(&payload); err != nil {
 		writeJSON(w, http.StatusBadRequest, ErrorResponse{Error: "Invalid request body"})
 		return
 	}
 	if err := h.storage.RemoveMultipleExpenses(payload.IDs); err != nil {
 		writeJSON(w, http.StatusInternalServerError, ErrorResponse{Error: "Failed to delete multiple expenses"})
-		log.Printf("API ERROR: Failed to delete multiple expenses: %v\n", err)
+		logAPIError(r, "Failed to delete multiple expenses", err)
 		return
 	}
 	writeJSON(w, http.StatusOK, map[string]string{"status": "success"})
@@ -289,8 +859,12 @@ func (h *Handler) AddRecurringExpense(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 	if err := h.storage.AddRecurringExpense(re); err != nil {
+		if errors.Is(err, storage.ErrInvalid) {
+			writeJSON(w, http.StatusBadRequest, ErrorResponse{Error: err.Error()})
+			return
+		}
 		writeJSON(w, http.StatusInternalServerError, ErrorResponse{Error: "Failed to add recurring expense"})
-		log.Printf("API ERROR: Failed to add recurring expense: %v\n", err)
+		logAPIError(r, "Failed to add recurring expense", err)
 		return
 	}
 	writeJSON(w, http.StatusCreated, re)
@@ -304,12 +878,74 @@ func (h *Handler) GetRecurringExpenses(w http.ResponseWriter, r *http.Request) {
 	res, err := h.storage.GetRecurringExpenses()
 	if err != nil {
 		writeJSON(w, http.StatusInternalServerError, ErrorResponse{Error: "Failed to get recurring expenses"})
-		log.Printf("API ERROR: Failed to get recurring expenses: %v\n", err)
+		logAPIError(r, "Failed to get recurring expenses", err)
 		return
 	}
 	writeJSON(w, http.StatusOK, res)
 }
 
+// recurring expense along with its upcoming schedule
+type RecurringExpenseWithNext struct {
+	storage.RecurringExpense
+	NextOccurrence       *time.Time `json:"nextOccurrence"` // nil once all occurrences are in the past
+	RemainingOccurrences int        `json:"remainingOccurrences"`
+}
+
+func (h *Handler) GetRecurringWithNext(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		writeJSON(w, http.StatusMethodNotAllowed, ErrorResponse{Error: "Method not allowed"})
+		return
+	}
+	config, err := h.storage.GetConfig()
+	if err != nil {
+		writeJSON(w, http.StatusInternalServerError, ErrorResponse{Error: "Failed to get recurring expenses"})
+		logAPIError(r, "Failed to get recurring expenses", err)
+		return
+	}
+	now := time.Now()
+	result := make([]RecurringExpenseWithNext, 0, len(config.RecurringExpenses))
+	for _, re := range config.RecurringExpenses {
+		item := RecurringExpenseWithNext{RecurringExpense: re}
+		next, remaining := storage.NextOccurrence(re, now, config.Holidays)
+		if remaining > 0 {
+			item.NextOccurrence = &next
+			item.RemainingOccurrences = remaining
+		}
+		result = append(result, item)
+	}
+	writeJSON(w, http.StatusOK, result)
+}
+
+// lists the expenses generated by a recurring rule, oldest first
+func (h *Handler) GetRecurringInstances(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		writeJSON(w, http.StatusMethodNotAllowed, ErrorResponse{Error: "Method not allowed"})
+		return
+	}
+	id := r.URL.Query().Get("id")
+	if id == "" {
+		writeJSON(w, http.StatusBadRequest, ErrorResponse{Error: "ID parameter is required"})
+		return
+	}
+	_, err := h.storage.GetRecurringExpense(id)
+	if errors.Is(err, storage.ErrNotFound) {
+		writeJSON(w, http.StatusNotFound, ErrorResponse{Error: "Recurring expense not found"})
+		return
+	}
+	if err != nil {
+		writeJSON(w, http.StatusInternalServerError, ErrorResponse{Error: "Failed to get recurring expense"})
+		logAPIError(r, "Failed to get recurring expense", err)
+		return
+	}
+	expenses, err := h.storage.GetExpensesByRecurringID(id)
+	if err != nil {
+		writeJSON(w, http.StatusInternalServerError, ErrorResponse{Error: "Failed to retrieve expenses"})
+		logAPIError(r, "Failed to retrieve recurring expense instances", err)
+		return
+	}
+	writeJSON(w, http.StatusOK, expenses)
+}
+
 func (h *Handler) UpdateRecurringExpense(w http.ResponseWriter, r *http.Request) {
 	if r.Method != http.MethodPut {
 		writeJSON(w, http.StatusMethodNotAllowed, ErrorResponse{Error: "Method not allowed"})
@@ -320,7 +956,11 @@ func (h *Handler) UpdateRecurringExpense(w http.ResponseWriter, r *http.Request)
 		writeJSON(w, http.StatusBadRequest, ErrorResponse{Error: "ID parameter is required"})
 		return
 	}
-	updateAll, _ := strconv.ParseBool(r.URL.Query().Get("updateAll"))
+	updateAll, err := parseOptionalBool(r.URL.Query().Get("updateAll"))
+	if err != nil {
+		writeJSON(w, http.StatusBadRequest, ErrorResponse{Error: "updateAll must be true or false"})
+		return
+	}
 
 	var re storage.RecurringExpense
 	if err := json.NewDecoder(r.Body).Decode(&re); err != nil {
@@ -332,13 +972,37 @@ func (h *Handler) UpdateRecurringExpense(w http.ResponseWriter, r *http.Request)
 		return
 	}
 	if err := h.storage.UpdateRecurringExpense(id, re, updateAll); err != nil {
+		if errors.Is(err, storage.ErrInvalid) {
+			writeJSON(w, http.StatusBadRequest, ErrorResponse{Error: err.Error()})
+			return
+		}
 		writeJSON(w, http.StatusInternalServerError, ErrorResponse{Error: "Failed to update recurring expense"})
-		log.Printf("API ERROR: Failed to update recurring expense: %v\n", err)
+		logAPIError(r, "Failed to update recurring expense", err)
 		return
 	}
 	writeJSON(w, http.StatusOK, map[string]string{"status": "success"})
 }
 
+// RegenerateResponse reports the instances created per recurring expense ID
+type RegenerateResponse struct {
+	Status  string         `json:"status"`
+	Created map[string]int `json:"created"`
+}
+
+func (h *Handler) RegenerateAllRecurring(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		writeJSON(w, http.StatusMethodNotAllowed, ErrorResponse{Error: "Method not allowed"})
+		return
+	}
+	created, err := h.storage.RegenerateRecurringExpenses()
+	if err != nil {
+		writeJSON(w, http.StatusInternalServerError, ErrorResponse{Error: "Failed to regenerate recurring expenses"})
+		logAPIError(r, "Failed to regenerate recurring expenses", err)
+		return
+	}
+	writeJSON(w, http.StatusOK, RegenerateResponse{Status: "success", Created: created})
+}
+
 func (h *Handler) DeleteRecurringExpense(w http.ResponseWriter, r *http.Request) {
 	if r.Method != http.MethodDelete {
 		writeJSON(w, http.StatusMethodNotAllowed, ErrorResponse{Error: "Method not allowed"})
@@ -349,16 +1013,65 @@ func (h *Handler) DeleteRecurringExpense(w http.ResponseWriter, r *http.Request)
 		writeJSON(w, http.StatusBadRequest, ErrorResponse{Error: "ID parameter is required"})
 		return
 	}
-	removeAll, _ := strconv.ParseBool(r.URL.Query().Get("removeAll"))
+	removeAll, err := parseOptionalBool(r.URL.Query().Get("removeAll"))
+	if err != nil {
+		writeJSON(w, http.StatusBadRequest, ErrorResponse{Error: "removeAll must be true or false"})
+		return
+	}
 
 	if err := h.storage.RemoveRecurringExpense(id, removeAll); err != nil {
 		writeJSON(w, http.StatusInternalServerError, ErrorResponse{Error: "Failed to delete recurring expense"})
-		log.Printf("API ERROR: Failed to delete recurring expense: %v\n", err)
+		logAPIError(r, "Failed to delete recurring expense", err)
 		return
 	}
 	writeJSON(w, http.StatusOK, map[string]string{"status": "success"})
 }
 
+// ------------------------------------------------------------
+// Audit Log Handlers
+// ------------------------------------------------------------
+
+const (
+	defaultAuditLimit = 50
+	maxAuditLimit     = 500
+)
+
+// parses an optional non-negative integer query value, returning fallback when empty
+func parseOptionalInt(value string, fallback int) (int, error) {
+	if value == "" {
+		return fallback, nil
+	}
+	n, err := strconv.Atoi(value)
+	if err != nil || n < 0 {
+		return 0, fmt.Errorf("invalid value: %s", value)
+	}
+	return n, nil
+}
+
+func (h *Handler) GetAuditLog(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		writeJSON(w, http.StatusMethodNotAllowed, ErrorResponse{Error: "Method not allowed"})
+		return
+	}
+	limit, err := parseOptionalInt(r.URL.Query().Get("limit"), defaultAuditLimit)
+	if err != nil || limit == 0 || limit > maxAuditLimit {
+		writeJSON(w, http.StatusBadRequest, ErrorResponse{Error: fmt.Sprintf("limit must be between 1 and %d", maxAuditLimit)})
+		return
+	}
+	offset, err := parseOptionalInt(r.URL.Query().Get("offset"), 0)
+	if err != nil {
+		writeJSON(w, http.StatusBadRequest, ErrorResponse{Error: "offset must be a non-negative integer"})
+		return
+	}
+	entries, err := h.storage.GetAuditLog(limit, offset)
+	if err != nil {
+		writeJSON(w, http.StatusInternalServerError, ErrorResponse{Error: "Failed to retrieve audit log"})
+		logAPIError(r, "Failed to retrieve audit log", err)
+		return
+	}
+	writeJSON(w, http.StatusOK, entries)
+}
+
 // ------------------------------------------------------------
 // Static and UI Handlers
 // ------------------------------------------------------------
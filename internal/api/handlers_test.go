@@ -0,0 +1,36 @@
+package api
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/tanq16/expenseowl/internal/storage"
+)
+
+func TestDuplicateExpenseRespectsStrictCategories(t *testing.T) {
+	store, err := storage.InitializeJsonStore(storage.SystemConfig{StorageURL: t.TempDir()})
+	if err != nil {
+		t.Fatal(err)
+	}
+	// added before strict categories were turned on
+	if err := store.AddExpense(storage.Expense{ID: "a", Name: "Gadget", Category: "Gadgets", Amount: -99, Date: time.Now()}); err != nil {
+		t.Fatal(err)
+	}
+	if err := store.UpdateStrictCategories(true); err != nil {
+		t.Fatal(err)
+	}
+	rec := httptest.NewRecorder()
+	NewHandler(store).DuplicateExpense(rec, httptest.NewRequest(http.MethodPost, "/expense/duplicate?id=a", nil))
+	if rec.Code != http.StatusBadRequest {
+		t.Errorf("status %d, want 400: %s", rec.Code, rec.Body)
+	}
+	expenses, err := store.GetAllExpenses()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(expenses) != 1 {
+		t.Errorf("got %d expenses, want the original only", len(expenses))
+	}
+}
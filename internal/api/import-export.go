@@ -2,6 +2,8 @@ package api
 
 import (
 	"encoding/csv"
+	"encoding/json"
+	"errors"
 	"fmt"
 	"log"
 	"net/http"
@@ -22,7 +24,7 @@ func (h *Handler) ExportCSV(w http.ResponseWriter, r *http.Request) {
 	expenses, err := h.storage.GetAllExpenses()
 	if err != nil {
 		writeJSON(w, http.StatusInternalServerError, ErrorResponse{Error: "Failed to retrieve expenses"})
-		log.Printf("API ERROR: Failed to retrieve expenses for CSV export: %v\n", err)
+		logAPIError(r, "Failed to retrieve expenses for CSV export", err)
 		return
 	}
 	w.Header().Set("Content-Type", "text/csv")
@@ -33,7 +35,7 @@ func (h *Handler) ExportCSV(w http.ResponseWriter, r *http.Request) {
 	// Write header
 	headers := []string{"ID", "Name", "Category", "Amount", "Date", "Tags"}
 	if err := writer.Write(headers); err != nil {
-		log.Printf("API ERROR: Failed to write CSV header: %v\n", err)
+		logAPIError(r, "Failed to write CSV header", err)
 		return
 	}
 
@@ -49,13 +51,53 @@ func (h *Handler) ExportCSV(w http.ResponseWriter, r *http.Request) {
 			strings.Join(expense.Tags, ","),
 		}
 		if err := writer.Write(record); err != nil {
-			log.Printf("API ERROR: Failed to write CSV record for expense ID %s: %v\n", expense.ID, err)
+			logAPIError(r, "Failed to write CSV record", err, "expense_id", expense.ID)
 			continue
 		}
 	}
 	log.Println("HTTP: Exported expenses to CSV")
 }
 
+// number of expenses written between flushes of the NDJSON stream
+const ndjsonFlushEvery = 100
+
+// streams all expenses as newline-delimited JSON, one expense per line, as
+// they are read from storage
+func (h *Handler) StreamExpensesNDJSON(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		writeJSON(w, http.StatusMethodNotAllowed, ErrorResponse{Error: "Method not allowed"})
+		return
+	}
+	w.Header().Set("Content-Type", "application/x-ndjson")
+	w.Header().Set("Content-Disposition", "attachment; filename=expenses.ndjson")
+	encoder := json.NewEncoder(w)
+	rc := http.NewResponseController(w)
+	count := 0
+	err := h.storage.EachExpense(func(expense storage.Expense) error {
+		if err := encoder.Encode(expense); err != nil { // Encode ends each value with a newline
+			return err
+		}
+		count++
+		// push batches out as they're written rather than when the buffer fills
+		if count%ndjsonFlushEvery == 0 {
+			if err := rc.Flush(); err != nil && !errors.Is(err, http.ErrNotSupported) {
+				return err
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		if count == 0 {
+			// nothing has been written, so the error can still be reported
+			w.Header().Del("Content-Disposition")
+			writeJSON(w, http.StatusInternalServerError, ErrorResponse{Error: "Failed to retrieve expenses"})
+		}
+		logAPIError(r, "Failed to stream expenses as NDJSON", err)
+		return
+	}
+	log.Printf("HTTP: Exported %d expenses as NDJSON\n", count)
+}
+
 // imports expenses from CSV
 func (h *Handler) ImportCSV(w http.ResponseWriter, r *http.Request) {
 	if r.Method != http.MethodPost {
@@ -101,11 +143,12 @@ func (h *Handler) ImportCSV(w http.ResponseWriter, r *http.Request) {
 	tagsIdx, tagsExists := colMap["tags"]
 	currencyIdx, currencyExists := colMap["currency"]
 
-	currentCategories, err := h.storage.GetCategories()
+	config, err := h.storage.GetConfig()
 	if err != nil {
 		writeJSON(w, http.StatusInternalServerError, ErrorResponse{Error: "Could not retrieve current categories"})
 		return
 	}
+	currentCategories := config.Categories
 	categorySet := make(map[string]bool)
 	for _, cat := range currentCategories {
 		categorySet[strings.ToLower(cat)] = true
@@ -162,7 +205,8 @@ func (h *Handler) ImportCSV(w http.ResponseWriter, r *http.Request) {
 			continue
 		}
 		category := strings.TrimSpace(record[colMap["category"]])
-		if _, ok := categorySet[strings.ToLower(category)]; !ok {
+		// strict categories reject the row below instead of adding its category
+		if _, ok := categorySet[strings.ToLower(category)]; !ok && !config.StrictCategories {
 			newCategories = append(newCategories, category)
 			categorySet[strings.ToLower(category)] = true // Add to set to handle duplicates in the same file
 		}
@@ -255,11 +299,12 @@ func (h *Handler) ImportOldCSV(w http.ResponseWriter, r *http.Request) {
 		}
 	}
 
-	currentCategories, err := h.storage.GetCategories()
+	config, err := h.storage.GetConfig()
 	if err != nil {
 		writeJSON(w, http.StatusInternalServerError, ErrorResponse{Error: "Could not retrieve current categories"})
 		return
 	}
+	currentCategories := config.Categories
 	categorySet := make(map[string]bool)
 	for _, cat := range currentCategories {
 		categorySet[strings.ToLower(cat)] = true
@@ -286,7 +331,8 @@ func (h *Handler) ImportOldCSV(w http.ResponseWriter, r *http.Request) {
 			continue
 		}
 		category := strings.TrimSpace(record[colMap["category"]])
-		if _, ok := categorySet[strings.ToLower(category)]; !ok {
+		// strict categories reject the row below instead of adding its category
+		if _, ok := categorySet[strings.ToLower(category)]; !ok && !config.StrictCategories {
 			newCategories = append(newCategories, category)
 			categorySet[strings.ToLower(category)] = true // Add to set to handle duplicates in the same file
 		}
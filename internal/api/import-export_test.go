@@ -0,0 +1,87 @@
+package api
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"mime/multipart"
+	"net/http"
+	"net/http/httptest"
+	"slices"
+	"testing"
+	"time"
+
+	"github.com/tanq16/expenseowl/internal/storage"
+)
+
+func TestStreamExpensesNDJSONFlushesThroughMiddleware(t *testing.T) {
+	store, err := storage.InitializeJsonStore(storage.SystemConfig{StorageURL: t.TempDir()})
+	if err != nil {
+		t.Fatal(err)
+	}
+	var expenses []storage.Expense
+	for range ndjsonFlushEvery + 1 {
+		expenses = append(expenses, storage.Expense{Name: "coffee", Category: "Food", Amount: -3, Date: time.Now()})
+	}
+	if err := store.AddMultipleExpenses(expenses); err != nil {
+		t.Fatal(err)
+	}
+
+	handler := NewHandler(store)
+	rec := httptest.NewRecorder()
+	WithRequestLogging(http.HandlerFunc(handler.StreamExpensesNDJSON)).ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/export/ndjson", nil))
+	if rec.Code != http.StatusOK {
+		t.Fatalf("status %d: %s", rec.Code, rec.Body)
+	}
+	if !rec.Flushed {
+		t.Error("stream was never flushed through the status recorder")
+	}
+	lines := 0
+	for scanner := bufio.NewScanner(rec.Body); scanner.Scan(); {
+		lines++
+	}
+	if lines != len(expenses) {
+		t.Errorf("streamed %d lines, want %d", lines, len(expenses))
+	}
+}
+
+func TestImportCSVRespectsStrictCategories(t *testing.T) {
+	store, err := storage.InitializeJsonStore(storage.SystemConfig{StorageURL: t.TempDir()})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := store.UpdateStrictCategories(true); err != nil {
+		t.Fatal(err)
+	}
+	var body bytes.Buffer
+	form := multipart.NewWriter(&body)
+	file, err := form.CreateFormFile("file", "expenses.csv")
+	if err != nil {
+		t.Fatal(err)
+	}
+	file.Write([]byte("name,category,amount,date\nLunch,Food,-12,2025-03-01\nGadget,Gadgets,-99,2025-03-02\n"))
+	form.Close()
+	req := httptest.NewRequest(http.MethodPost, "/import/csv", &body)
+	req.Header.Set("Content-Type", form.FormDataContentType())
+	rec := httptest.NewRecorder()
+	NewHandler(store).ImportCSV(rec, req)
+
+	var result struct {
+		Imported      int      `json:"imported"`
+		Skipped       int      `json:"skipped"`
+		NewCategories []string `json:"new_categories"`
+	}
+	if err := json.NewDecoder(rec.Body).Decode(&result); err != nil {
+		t.Fatal(err)
+	}
+	if result.Imported != 1 || result.Skipped != 1 || len(result.NewCategories) != 0 {
+		t.Errorf("imported %d, skipped %d, new categories %v; want 1, 1, none", result.Imported, result.Skipped, result.NewCategories)
+	}
+	categories, err := store.GetCategories()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if slices.Contains(categories, "Gadgets") {
+		t.Error("strict import added the unknown category")
+	}
+}
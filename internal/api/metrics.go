@@ -0,0 +1,100 @@
+package api
+
+import (
+	"log"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/collectors"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+	"github.com/tanq16/expenseowl/internal/storage"
+)
+
+// request latency buckets in seconds
+var durationBuckets = []float64{0.005, 0.01, 0.025, 0.05, 0.1, 0.25, 0.5, 1, 2.5, 5, 10}
+
+// storage calls are mostly single queries, so the buckets start lower
+var queryBuckets = []float64{0.0005, 0.001, 0.0025, 0.005, 0.01, 0.025, 0.05, 0.1, 0.25, 0.5, 1, 2.5}
+
+// appMetrics holds the collectors served at /metrics, registered on a registry
+// of their own so every Handler can have one
+type appMetrics struct {
+	registry *prometheus.Registry
+	requests *prometheus.HistogramVec
+	queries  *prometheus.HistogramVec
+}
+
+func newAppMetrics() *appMetrics {
+	m := &appMetrics{
+		registry: prometheus.NewRegistry(),
+		requests: prometheus.NewHistogramVec(prometheus.HistogramOpts{
+			Name:    "expenseowl_http_request_duration_seconds",
+			Help:    "Duration of HTTP requests by handler.",
+			Buckets: durationBuckets,
+		}, []string{"handler", "method", "status"}),
+		queries: prometheus.NewHistogramVec(prometheus.HistogramOpts{
+			Name:    "expenseowl_db_query_duration_seconds",
+			Help:    "Duration of storage calls by operation.",
+			Buckets: queryBuckets,
+		}, []string{"operation"}),
+	}
+	m.registry.MustRegister(m.requests, m.queries, collectors.NewGoCollector(), collectors.NewProcessCollector(collectors.ProcessCollectorOpts{}))
+	return m
+}
+
+func (m *appMetrics) observeQuery(operation string, duration time.Duration) {
+	m.queries.WithLabelValues(operation).Observe(duration.Seconds())
+}
+
+var (
+	expensesDesc  = prometheus.NewDesc("expenseowl_expenses", "Number of stored expenses.", nil, nil)
+	recurringDesc = prometheus.NewDesc("expenseowl_recurring_expenses", "Number of recurring expense rules.", nil, nil)
+)
+
+// reports the row counts at scrape time with a count query rather than
+// loading the rows
+type countsCollector struct {
+	storage storage.Storage
+}
+
+func (c countsCollector) Describe(ch chan<- *prometheus.Desc) {
+	ch <- expensesDesc
+	ch <- recurringDesc
+}
+
+func (c countsCollector) Collect(ch chan<- prometheus.Metric) {
+	counts, err := c.storage.Counts()
+	if err != nil {
+		log.Printf("API ERROR: Failed to count rows for metrics: %v\n", err)
+		ch <- prometheus.NewInvalidMetric(expensesDesc, err)
+		return
+	}
+	ch <- prometheus.MustNewConstMetric(expensesDesc, prometheus.GaugeValue, float64(counts.Expenses))
+	ch <- prometheus.MustNewConstMetric(recurringDesc, prometheus.GaugeValue, float64(counts.RecurringExpenses))
+}
+
+// WithMetrics records the latency of every request, labeled by the route
+// pattern it matched so unknown paths don't create new series
+func (h *Handler) WithMetrics(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		start := time.Now()
+		rec := &statusRecorder{ResponseWriter: w, status: http.StatusOK}
+		next.ServeHTTP(rec, r)
+		handler := r.Pattern // set by the mux once it routes the request
+		if handler == "" {
+			handler = "unmatched"
+		}
+		h.metrics.requests.WithLabelValues(handler, r.Method, strconv.Itoa(rec.status)).Observe(time.Since(start).Seconds())
+	})
+}
+
+// serves metrics in the Prometheus exposition format
+func (h *Handler) Metrics(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		writeJSON(w, http.StatusMethodNotAllowed, ErrorResponse{Error: "Method not allowed"})
+		return
+	}
+	promhttp.HandlerFor(h.metrics.registry, promhttp.HandlerOpts{ErrorLog: log.Default()}).ServeHTTP(w, r)
+}
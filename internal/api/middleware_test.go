@@ -0,0 +1,38 @@
+package api
+
+import (
+	"bytes"
+	"errors"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestRequestIDReachesHandlerLogs(t *testing.T) {
+	var logs bytes.Buffer
+	logger := slog.Default()
+	slog.SetDefault(slog.New(slog.NewTextHandler(&logs, nil)))
+	t.Cleanup(func() { slog.SetDefault(logger) })
+
+	var seen string
+	handler := WithRequestLogging(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		seen = RequestID(r.Context())
+		logAPIError(r, "Failed to do something", errors.New("boom"), "expense_id", "e1")
+	}))
+	req := httptest.NewRequest(http.MethodGet, "/expenses", nil)
+	req.Header.Set("X-Request-ID", "abc-%d-123")
+	rec := httptest.NewRecorder()
+	handler.ServeHTTP(rec, req)
+
+	if seen != "abc-%d-123" {
+		t.Errorf("handler saw request ID %q, want abc-%%d-123", seen)
+	}
+	if got := rec.Header().Get("X-Request-ID"); got != seen {
+		t.Errorf("response has request ID %q, handler saw %q", got, seen)
+	}
+	if want := `level=ERROR msg="Failed to do something" request_id=abc-%d-123 error=boom expense_id=e1`; !strings.Contains(logs.String(), want) {
+		t.Errorf("log %q doesn't contain %q", logs.String(), want)
+	}
+}
@@ -0,0 +1,246 @@
+package api
+
+import (
+	"encoding/json"
+	"net/http"
+	"reflect"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/tanq16/expenseowl/internal/storage"
+)
+
+type apiParam struct {
+	name        string
+	kind        string // OpenAPI type of the query value
+	required    bool
+	description string
+}
+
+// one documented route; request and response are the Go types the handler
+// decodes and encodes, nil when there is no body
+type apiOperation struct {
+	path     string
+	method   string
+	summary  string
+	params   []apiParam
+	request  reflect.Type
+	optional bool // the request body may be left out
+	status   int
+	response reflect.Type
+}
+
+var idParam = apiParam{name: "id", kind: "string", required: true, description: "ID of the expense or recurring expense"}
+
+// status body returned by most updates
+type statusResponse map[string]string
+
+var apiOperations = []apiOperation{
+	{path: "/healthz", method: http.MethodGet, summary: "Check that the storage backend is usable", status: http.StatusOK, response: reflect.TypeFor[HealthResponse]()},
+
+	{path: "/config", method: http.MethodGet, summary: "Get the full config", status: http.StatusOK, response: reflect.TypeFor[storage.Config]()},
+	{path: "/categories", method: http.MethodGet, summary: "List the categories", status: http.StatusOK, response: reflect.TypeFor[[]string]()},
+	{path: "/categories/used", method: http.MethodGet, summary: "List the categories used by expenses, flagging unconfigured ones", status: http.StatusOK, response: reflect.TypeFor[UsedCategories]()},
+	{path: "/categories/add", method: http.MethodPut, summary: "Add a category, leaving the others untouched", request: reflect.TypeFor[string](), status: http.StatusOK, response: reflect.TypeFor[statusResponse]()},
+	{path: "/categories/remove", method: http.MethodDelete, summary: "Remove a category", params: []apiParam{{name: "name", kind: "string", required: true, description: "category to remove"}}, status: http.StatusOK, response: reflect.TypeFor[statusResponse]()},
+	{path: "/categories/validate", method: http.MethodPost, summary: "Check category names without saving them", request: reflect.TypeFor[[]string](), status: http.StatusOK, response: reflect.TypeFor[[]CategoryValidation]()},
+	{path: "/categories/rename", method: http.MethodPut, summary: "Rename a category and move its expenses and recurring expenses", request: reflect.TypeFor[RenameCategoryRequest](), status: http.StatusOK, response: reflect.TypeFor[statusResponse]()},
+	{path: "/categories/merge", method: http.MethodPut, summary: "Fold categories into a target and move their expenses and recurring expenses", request: reflect.TypeFor[MergeCategoriesRequest](), status: http.StatusOK, response: reflect.TypeFor[statusResponse]()},
+	{path: "/categories/edit", method: http.MethodPut, summary: "Replace the categories", request: reflect.TypeFor[[]string](), status: http.StatusOK, response: reflect.TypeFor[statusResponse]()},
+	{path: "/categories/colors", method: http.MethodGet, summary: "Get the color of every category", status: http.StatusOK, response: reflect.TypeFor[map[string]string]()},
+	{path: "/categories/colors/edit", method: http.MethodPut, summary: "Replace the explicit category colors (#rrggbb)", request: reflect.TypeFor[map[string]string](), status: http.StatusOK, response: reflect.TypeFor[statusResponse]()},
+	{path: "/categories/strict/edit", method: http.MethodPut, summary: "Turn rejecting expenses in unconfigured categories on or off", request: reflect.TypeFor[bool](), status: http.StatusOK, response: reflect.TypeFor[statusResponse]()},
+	{path: "/currency", method: http.MethodGet, summary: "Get the currency code", status: http.StatusOK, response: reflect.TypeFor[string]()},
+	{path: "/currency/edit", method: http.MethodPut, summary: "Set the currency code", request: reflect.TypeFor[string](), status: http.StatusOK, response: reflect.TypeFor[statusResponse]()},
+	{path: "/supported", method: http.MethodGet, summary: "List the currencies the backend accepts", status: http.StatusOK, response: reflect.TypeFor[SupportedResponse]()},
+	{path: "/startdate", method: http.MethodGet, summary: "Get the day of the month budget periods start on", status: http.StatusOK, response: reflect.TypeFor[int]()},
+	{path: "/startdate/edit", method: http.MethodPut, summary: "Set the day of the month budget periods start on (1-31)", request: reflect.TypeFor[int](), status: http.StatusOK, response: reflect.TypeFor[statusResponse]()},
+	{path: "/symbolposition/edit", method: http.MethodPut, summary: "Set the currency symbol position (default, left, or right)", request: reflect.TypeFor[string](), status: http.StatusOK, response: reflect.TypeFor[statusResponse]()},
+	{path: "/grouping/edit", method: http.MethodPut, summary: "Replace the currencies shown without thousands grouping", request: reflect.TypeFor[[]string](), status: http.StatusOK, response: reflect.TypeFor[statusResponse]()},
+	{path: "/numberlocale/edit", method: http.MethodPut, summary: "Set the locale (eg. ms-MY) for digit grouping and decimal marks, empty to follow the currency", request: reflect.TypeFor[string](), status: http.StatusOK, response: reflect.TypeFor[statusResponse]()},
+	{path: "/separators/edit", method: http.MethodPut, summary: "Set the thousands and decimal separators, both empty to follow the number locale", request: reflect.TypeFor[SeparatorsRequest](), status: http.StatusOK, response: reflect.TypeFor[statusResponse]()},
+	{path: "/holidays/edit", method: http.MethodPut, summary: "Replace the holidays (YYYY-MM-DD) skipped by recurring rules", request: reflect.TypeFor[[]string](), status: http.StatusOK, response: reflect.TypeFor[statusResponse]()},
+
+	{path: "/expense", method: http.MethodPut, summary: "Add an expense", request: reflect.TypeFor[storage.Expense](), status: http.StatusOK, response: reflect.TypeFor[storage.Expense]()},
+	{path: "/expenses", method: http.MethodGet, summary: "List all expenses", status: http.StatusOK, response: reflect.TypeFor[[]storage.Expense]()},
+	{path: "/expense/get", method: http.MethodGet, summary: "Get an expense", params: []apiParam{idParam}, status: http.StatusOK, response: reflect.TypeFor[storage.Expense]()},
+	{path: "/expenses/get", method: http.MethodPost, summary: "Get several expenses by ID", request: reflect.TypeFor[ExpenseIDsRequest](), status: http.StatusOK, response: reflect.TypeFor[ExpensesByIDsResponse]()},
+	{path: "/expense/edit", method: http.MethodPut, summary: "Replace an expense", params: []apiParam{idParam}, request: reflect.TypeFor[storage.Expense](), status: http.StatusOK, response: reflect.TypeFor[storage.Expense]()},
+	{path: "/expense/patch", method: http.MethodPatch, summary: "Update only the fields present in the body", params: []apiParam{idParam}, request: reflect.TypeFor[storage.Expense](), status: http.StatusOK, response: reflect.TypeFor[storage.Expense]()},
+	{path: "/expense/duplicate", method: http.MethodPost, summary: "Copy an expense, dated now unless a date is given", params: []apiParam{idParam}, request: reflect.TypeFor[struct {
+		Date time.Time `json:"date,omitempty"`
+	}](), optional: true, status: http.StatusOK, response: reflect.TypeFor[storage.Expense]()},
+	{path: "/expense/delete", method: http.MethodDelete, summary: "Delete an expense", params: []apiParam{idParam}, status: http.StatusOK, response: reflect.TypeFor[statusResponse]()},
+	{path: "/expenses/delete", method: http.MethodDelete, summary: "Delete several expenses by ID", request: reflect.TypeFor[ExpenseIDsRequest](), status: http.StatusOK, response: reflect.TypeFor[statusResponse]()},
+
+	{path: "/recurring-expense", method: http.MethodPut, summary: "Add a recurring expense and generate its instances", request: reflect.TypeFor[storage.RecurringExpense](), status: http.StatusCreated, response: reflect.TypeFor[storage.RecurringExpense]()},
+	{path: "/recurring-expenses", method: http.MethodGet, summary: "List the recurring expenses", status: http.StatusOK, response: reflect.TypeFor[[]storage.RecurringExpense]()},
+	{path: "/recurring-expenses/next", method: http.MethodGet, summary: "List the recurring expenses with their next occurrence", status: http.StatusOK, response: reflect.TypeFor[[]RecurringExpenseWithNext]()},
+	{path: "/recurring-expense/instances", method: http.MethodGet, summary: "List the expenses generated by a recurring expense, oldest first", params: []apiParam{idParam}, status: http.StatusOK, response: reflect.TypeFor[[]storage.Expense]()},
+	{path: "/recurring-expense/edit", method: http.MethodPut, summary: "Replace a recurring expense and regenerate its instances", params: []apiParam{idParam, {name: "updateAll", kind: "boolean", description: "also regenerate past instances"}}, request: reflect.TypeFor[storage.RecurringExpense](), status: http.StatusOK, response: reflect.TypeFor[statusResponse]()},
+	{path: "/recurring-expenses/regenerate", method: http.MethodPost, summary: "Regenerate the future instances of every recurring expense", status: http.StatusOK, response: reflect.TypeFor[RegenerateResponse]()},
+	{path: "/recurring-expense/delete", method: http.MethodDelete, summary: "Delete a recurring expense and its future instances", params: []apiParam{idParam, {name: "removeAll", kind: "boolean", description: "also delete past instances"}}, status: http.StatusOK, response: reflect.TypeFor[statusResponse]()},
+
+	{path: "/breakdown/yearly", method: http.MethodGet, summary: "Get income and expenses per budget period of a year", params: []apiParam{{name: "year", kind: "integer", description: "defaults to the current year"}}, status: http.StatusOK, response: reflect.TypeFor[YearlyBreakdown]()},
+	{path: "/audit", method: http.MethodGet, summary: "Get the audit log, newest first", params: []apiParam{{name: "limit", kind: "integer", description: "defaults to 50, at most 500"}, {name: "offset", kind: "integer"}}, status: http.StatusOK, response: reflect.TypeFor[[]storage.AuditEntry]()},
+}
+
+// routes left out of the spec on purpose: pages and static files, CSV and
+// NDJSON imports and exports that aren't JSON bodies, plain-text /version and
+// /metrics, and the spec itself
+var undocumentedPaths = []string{
+	"/", "/table", "/settings",
+	"/functions.js", "/manifest.json", "/sw.js", "/pwa/", "/style.css", "/favicon.ico", "/chart.min.js", "/fa.min.css", "/webfonts/",
+	"/export/csv", "/export/ndjson", "/import/csv", "/import/csvold",
+	"/version", "/metrics", "/openapi.json",
+}
+
+var (
+	timeType       = reflect.TypeFor[time.Time]()
+	rawMessageType = reflect.TypeFor[json.RawMessage]()
+)
+
+// builds JSON schemas from Go types the way encoding/json sees them, adding
+// named structs to components so they are described once
+type schemaGenerator struct {
+	components map[string]any
+}
+
+func (g *schemaGenerator) schema(t reflect.Type) map[string]any {
+	switch {
+	case t == timeType:
+		return map[string]any{"type": "string", "format": "date-time"}
+	case t == rawMessageType:
+		return map[string]any{} // any JSON value
+	}
+	switch t.Kind() {
+	case reflect.Pointer:
+		return g.schema(t.Elem())
+	case reflect.String:
+		return map[string]any{"type": "string"}
+	case reflect.Bool:
+		return map[string]any{"type": "boolean"}
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
+		reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		return map[string]any{"type": "integer"}
+	case reflect.Float32, reflect.Float64:
+		return map[string]any{"type": "number", "format": "double"}
+	case reflect.Slice, reflect.Array:
+		return map[string]any{"type": "array", "items": g.schema(t.Elem())}
+	case reflect.Map:
+		return map[string]any{"type": "object", "additionalProperties": g.schema(t.Elem())}
+	case reflect.Struct:
+		if t.Name() == "" {
+			return g.objectSchema(t)
+		}
+		if _, ok := g.components[t.Name()]; !ok {
+			g.components[t.Name()] = nil // placeholder in case the type refers to itself
+			g.components[t.Name()] = g.objectSchema(t)
+		}
+		return map[string]any{"$ref": "#/components/schemas/" + t.Name()}
+	}
+	return map[string]any{}
+}
+
+// describes the fields of a struct, flattening embedded structs; nothing is
+// marked required since the same schemas describe requests, where the server
+// fills in missing fields, and responses
+func (g *schemaGenerator) objectSchema(t reflect.Type) map[string]any {
+	properties := make(map[string]any)
+	g.addFields(t, properties)
+	return map[string]any{"type": "object", "properties": properties}
+}
+
+func (g *schemaGenerator) addFields(t reflect.Type, properties map[string]any) {
+	for i := range t.NumField() {
+		field := t.Field(i)
+		tag := field.Tag.Get("json")
+		if tag == "-" || (!field.IsExported() && !field.Anonymous) {
+			continue
+		}
+		name, _, _ := strings.Cut(tag, ",")
+		if field.Anonymous && name == "" && field.Type.Kind() == reflect.Struct {
+			g.addFields(field.Type, properties)
+			continue
+		}
+		if name == "" {
+			name = field.Name
+		}
+		properties[name] = g.schema(field.Type)
+	}
+}
+
+// generates the OpenAPI document for the JSON API from apiOperations
+func buildOpenAPISpec() ([]byte, error) {
+	g := &schemaGenerator{components: make(map[string]any)}
+	errorResponse := map[string]any{
+		"description": "Error",
+		"content":     map[string]any{"application/json": map[string]any{"schema": g.schema(reflect.TypeFor[ErrorResponse]())}},
+	}
+	paths := make(map[string]map[string]any)
+	for _, op := range apiOperations {
+		operation := map[string]any{
+			"summary": op.summary,
+			"responses": map[string]any{
+				strconv.Itoa(op.status): map[string]any{
+					"description": http.StatusText(op.status),
+					"content":     map[string]any{"application/json": map[string]any{"schema": g.schema(op.response)}},
+				},
+				"default": errorResponse,
+			},
+		}
+		if len(op.params) > 0 {
+			params := make([]map[string]any, 0, len(op.params))
+			for _, p := range op.params {
+				param := map[string]any{"name": p.name, "in": "query", "required": p.required, "schema": map[string]any{"type": p.kind}}
+				if p.description != "" {
+					param["description"] = p.description
+				}
+				params = append(params, param)
+			}
+			operation["parameters"] = params
+		}
+		if op.request != nil {
+			operation["requestBody"] = map[string]any{
+				"required": !op.optional,
+				"content":  map[string]any{"application/json": map[string]any{"schema": g.schema(op.request)}},
+			}
+		}
+		if paths[op.path] == nil {
+			paths[op.path] = make(map[string]any)
+		}
+		paths[op.path][strings.ToLower(op.method)] = operation
+	}
+	return json.MarshalIndent(map[string]any{
+		"openapi": "3.0.3",
+		"info": map[string]any{
+			"title":       "ExpenseOwl API",
+			"version":     "1.0.0",
+			"description": "Amounts are floats, negative for expenses and positive for income. Dates are RFC3339 timestamps.",
+		},
+		"paths":      paths,
+		"components": map[string]any{"schemas": g.components},
+	}, "", "  ")
+}
+
+// the spec only depends on the Go types, so it is generated once
+var openAPISpec = sync.OnceValues(buildOpenAPISpec)
+
+// serves an OpenAPI 3 document describing the JSON API, generated from the
+// request and response types
+func (h *Handler) OpenAPISpec(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		writeJSON(w, http.StatusMethodNotAllowed, ErrorResponse{Error: "Method not allowed"})
+		return
+	}
+	spec, err := openAPISpec()
+	if err != nil {
+		writeJSON(w, http.StatusInternalServerError, ErrorResponse{Error: "Failed to generate OpenAPI spec"})
+		logAPIError(r, "Failed to generate OpenAPI spec", err)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.Write(spec)
+}
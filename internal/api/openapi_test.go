@@ -0,0 +1,49 @@
+package api
+
+import (
+	"encoding/json"
+	"os"
+	"regexp"
+	"slices"
+	"testing"
+)
+
+// every route registered in main.go must be documented or deliberately left out
+func TestOpenAPICoversRoutes(t *testing.T) {
+	source, err := os.ReadFile("../../cmd/expenseowl/main.go")
+	if err != nil {
+		t.Fatal(err)
+	}
+	routes := regexp.MustCompile(`(?m)^\s*http\.HandleFunc\("([^"]+)"`).FindAllSubmatch(source, -1)
+	if len(routes) == 0 {
+		t.Fatal("no routes found in main.go")
+	}
+	documented := make(map[string]bool)
+	for _, op := range apiOperations {
+		documented[op.path] = true
+	}
+	for _, route := range routes {
+		path := string(route[1])
+		if !documented[path] && !slices.Contains(undocumentedPaths, path) {
+			t.Errorf("route %s is neither in apiOperations nor in undocumentedPaths", path)
+		}
+	}
+}
+
+func TestOpenAPISpecBuilds(t *testing.T) {
+	spec, err := buildOpenAPISpec()
+	if err != nil {
+		t.Fatal(err)
+	}
+	var doc struct {
+		Paths map[string]map[string]any `json:"paths"`
+	}
+	if err := json.Unmarshal(spec, &doc); err != nil {
+		t.Fatal(err)
+	}
+	for _, op := range apiOperations {
+		if _, ok := doc.Paths[op.path]; !ok {
+			t.Errorf("spec is missing %s", op.path)
+		}
+	}
+}
@@ -0,0 +1,188 @@
+package api
+
+import (
+	"cmp"
+	"math"
+	"net/http"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/tanq16/expenseowl/internal/storage"
+)
+
+// MonthlyTotals holds the cashflow of one budget period
+type MonthlyTotals struct {
+	Month    int       `json:"month"` // 1-12, the calendar month the period starts in
+	Start    time.Time `json:"start"`
+	End      time.Time `json:"end"` // exclusive
+	Income   float64   `json:"income"`
+	Expenses float64   `json:"expenses"` // positive total of outgoing amounts
+	Net      float64   `json:"net"`
+}
+
+// YearlyBreakdown holds the monthly cashflow for a year
+type YearlyBreakdown struct {
+	Year      int             `json:"year"`
+	StartDate int             `json:"startDate"`
+	Months    []MonthlyTotals `json:"months"`
+}
+
+// returns the first moment of the budget period beginning in the given month,
+// clamping the start day to the length of short months
+func periodStart(year int, month time.Month, startDay int, loc *time.Location) time.Time {
+	daysInMonth := time.Date(year, month+1, 0, 0, 0, 0, 0, loc).Day()
+	return time.Date(year, month, min(startDay, daysInMonth), 0, 0, 0, 0, loc)
+}
+
+// returns the half-open [start, end) budget period containing t
+func periodBounds(t time.Time, startDay int) (time.Time, time.Time) {
+	month := t.Month()
+	if t.Before(periodStart(t.Year(), month, startDay, t.Location())) {
+		month--
+	}
+	return periodStart(t.Year(), month, startDay, t.Location()), periodStart(t.Year(), month+1, startDay, t.Location())
+}
+
+// CategoryTotal is the amount spent in a category
+type CategoryTotal struct {
+	Category string  `json:"category"`
+	Color    string  `json:"color"`
+	Total    float64 `json:"total"`
+}
+
+// PeriodSummary holds the cashflow and category totals of one budget period
+type PeriodSummary struct {
+	Currency     string          `json:"currency"`
+	Start        time.Time       `json:"start"`
+	End          time.Time       `json:"end"` // exclusive
+	ExpenseCount int             `json:"expenseCount"`
+	Income       float64         `json:"income"`
+	Expenses     float64         `json:"expenses"` // positive total of outgoing amounts
+	Net          float64         `json:"net"`
+	Categories   []CategoryTotal `json:"categories"` // outgoing amounts by category, largest first
+}
+
+// returns the per-category portions of an expense, honoring splits if present
+func expenseParts(exp storage.Expense) []storage.ExpenseSplit {
+	if len(exp.Splits) > 0 {
+		return exp.Splits
+	}
+	return []storage.ExpenseSplit{{Category: exp.Category, Amount: exp.Amount}}
+}
+
+// summarizes the budget period containing now
+func summarizePeriod(s storage.Storage, now time.Time) (PeriodSummary, error) {
+	config, err := s.GetConfig()
+	if err != nil {
+		return PeriodSummary{}, err
+	}
+	expenses, err := s.GetAllExpenses()
+	if err != nil {
+		return PeriodSummary{}, err
+	}
+	start, end := periodBounds(now, config.StartDate)
+	summary := PeriodSummary{Currency: config.Currency, Start: start, End: end, Categories: []CategoryTotal{}}
+	var income, outgoing minorUnits
+	categoryTotals := make(map[string]minorUnits)
+	for _, exp := range expenses {
+		if exp.Date.Before(start) || !exp.Date.Before(end) {
+			continue
+		}
+		summary.ExpenseCount++
+		if exp.Amount > 0 {
+			income += toMinorUnits(exp.Amount)
+			continue
+		}
+		outgoing -= toMinorUnits(exp.Amount)
+		for _, part := range expenseParts(exp) {
+			categoryTotals[part.Category] -= toMinorUnits(part.Amount)
+		}
+	}
+	for category, total := range categoryTotals {
+		summary.Categories = append(summary.Categories, CategoryTotal{Category: category, Color: config.CategoryColor(category), Total: total.float()})
+	}
+	slices.SortFunc(summary.Categories, func(a, b CategoryTotal) int {
+		return cmp.Or(cmp.Compare(b.Total, a.Total), strings.Compare(a.Category, b.Category))
+	})
+	summary.Income = income.float()
+	summary.Expenses = outgoing.float()
+	summary.Net = (income - outgoing).float()
+	return summary, nil
+}
+
+// amounts are summed as integer thousandths, the precision they are stored
+// with, so totals over many expenses don't pick up float rounding errors
+type minorUnits int64
+
+const minorUnitsPerUnit = 1000
+
+func toMinorUnits(amount float64) minorUnits {
+	return minorUnits(math.Round(amount * minorUnitsPerUnit))
+}
+
+// converts back to an amount, only for output
+func (m minorUnits) float() float64 {
+	return float64(m) / minorUnitsPerUnit
+}
+
+// totals income and expenses per budget period for a year (?year=, defaults to
+// the current one), using the configured start date for period boundaries in
+// the server's local time zone
+func (h *Handler) GetYearlyBreakdown(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		writeJSON(w, http.StatusMethodNotAllowed, ErrorResponse{Error: "Method not allowed"})
+		return
+	}
+	year := time.Now().Year()
+	if value := r.URL.Query().Get("year"); value != "" {
+		parsed, err := strconv.Atoi(value)
+		if err != nil || parsed < 1 || parsed > 9999 {
+			writeJSON(w, http.StatusBadRequest, ErrorResponse{Error: "Invalid year"})
+			return
+		}
+		year = parsed
+	}
+	startDate, err := h.storage.GetStartDate()
+	if err != nil {
+		writeJSON(w, http.StatusInternalServerError, ErrorResponse{Error: "Failed to get start date"})
+		logAPIError(r, "Failed to get start date for yearly breakdown", err)
+		return
+	}
+	expenses, err := h.storage.GetAllExpenses()
+	if err != nil {
+		writeJSON(w, http.StatusInternalServerError, ErrorResponse{Error: "Failed to retrieve expenses"})
+		logAPIError(r, "Failed to retrieve expenses for yearly breakdown", err)
+		return
+	}
+
+	breakdown := YearlyBreakdown{Year: year, StartDate: startDate, Months: make([]MonthlyTotals, 12)}
+	for i := range breakdown.Months {
+		month := time.Month(i + 1)
+		breakdown.Months[i] = MonthlyTotals{
+			Month: i + 1,
+			Start: periodStart(year, month, startDate, time.Local),
+			End:   periodStart(year, month+1, startDate, time.Local),
+		}
+	}
+	var income, outgoing [12]minorUnits
+	for _, exp := range expenses {
+		start, _ := periodBounds(exp.Date.In(time.Local), startDate)
+		if start.Year() != year {
+			continue
+		}
+		if exp.Amount > 0 {
+			income[start.Month()-1] += toMinorUnits(exp.Amount)
+		} else {
+			outgoing[start.Month()-1] -= toMinorUnits(exp.Amount)
+		}
+	}
+	for i := range breakdown.Months {
+		totals := &breakdown.Months[i]
+		totals.Income = income[i].float()
+		totals.Expenses = outgoing[i].float()
+		totals.Net = (income[i] - outgoing[i]).float()
+	}
+	writeJSON(w, http.StatusOK, breakdown)
+}
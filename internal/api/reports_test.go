@@ -0,0 +1,76 @@
+package api
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/tanq16/expenseowl/internal/storage"
+)
+
+func TestMinorUnitsNoDrift(t *testing.T) {
+	var floatTotal float64
+	var total minorUnits
+	for range 10000 {
+		floatTotal += 0.1
+		total += toMinorUnits(0.1)
+	}
+	if floatTotal == 1000 {
+		t.Fatal("expected summing floats to drift, the test no longer shows anything")
+	}
+	if got := total.float(); got != 1000 {
+		t.Errorf("10,000 x 0.1 = %v, want 1000", got)
+	}
+
+	// the first six amounts cancel out, all seven net to +0.1
+	amounts := []float64{0.1, -0.2, 0.3, -0.1, 0.2, -0.3, 0.1}
+	total = 0
+	for i := range 12000 {
+		total += toMinorUnits(amounts[i%6])
+	}
+	if got := total.float(); got != 0 {
+		t.Errorf("mixed-sign total = %v, want 0", got)
+	}
+	total = 0
+	for i := range 12000 {
+		total += toMinorUnits(amounts[i%7])
+	}
+	// 1714 full cycles of +0.1, then +0.1, -0.2
+	if got := total.float(); got != 171.3 {
+		t.Errorf("mixed-sign total = %v, want 171.3", got)
+	}
+}
+
+func TestYearlyBreakdownNoDrift(t *testing.T) {
+	store, err := storage.InitializeJsonStore(storage.SystemConfig{StorageURL: t.TempDir()})
+	if err != nil {
+		t.Fatal(err)
+	}
+	date := time.Date(2025, time.March, 10, 12, 0, 0, 0, time.Local)
+	var expenses []storage.Expense
+	for range 10000 {
+		expenses = append(expenses,
+			storage.Expense{Name: "coffee", Category: "Food", Amount: -0.1, Date: date},
+			storage.Expense{Name: "refund", Category: "Income", Amount: 0.7, Date: date},
+		)
+	}
+	if err := store.AddMultipleExpenses(expenses); err != nil {
+		t.Fatal(err)
+	}
+
+	rec := httptest.NewRecorder()
+	NewHandler(store).GetYearlyBreakdown(rec, httptest.NewRequest(http.MethodGet, "/breakdown/yearly?year=2025", nil))
+	if rec.Code != http.StatusOK {
+		t.Fatalf("status %d: %s", rec.Code, rec.Body)
+	}
+	var breakdown YearlyBreakdown
+	if err := json.NewDecoder(rec.Body).Decode(&breakdown); err != nil {
+		t.Fatal(err)
+	}
+	march := breakdown.Months[time.March-1]
+	if march.Expenses != 1000 || march.Income != 7000 || march.Net != 6000 {
+		t.Errorf("got expenses %v, income %v, net %v; want 1000, 7000, 6000", march.Expenses, march.Income, march.Net)
+	}
+}
@@ -0,0 +1,174 @@
+package api
+
+import (
+	"bytes"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"time"
+
+	"github.com/tanq16/expenseowl/internal/storage"
+)
+
+const defaultWebhookInterval = 5 * time.Minute
+
+// most audit entries sent in one delivery; larger backlogs go out in batches
+const webhookBatchSize = 500
+
+// delays between delivery attempts; the first attempt is immediate
+var webhookBackoff = []time.Duration{2 * time.Second, 10 * time.Second, 30 * time.Second}
+
+// WebhookPayload is the signed JSON body posted to the webhook URL
+type WebhookPayload struct {
+	Event       string               `json:"event"`
+	GeneratedAt time.Time            `json:"generatedAt"`
+	Summary     PeriodSummary        `json:"summary"`
+	Changes     []storage.AuditEntry `json:"changes"` // audit entries since the last delivery, oldest first
+}
+
+// Webhook posts the changes recorded in the audit log since the last
+// successful delivery, along with a summary of the current period
+type Webhook struct {
+	url      string
+	secret   string
+	storage  storage.Storage
+	client   *http.Client
+	lastSent string // ID of the newest audit entry covered by a delivery
+	ready    bool   // lastSent has been read from the audit log
+}
+
+func NewWebhook(url, secret string, s storage.Storage) *Webhook {
+	return &Webhook{
+		url:     url,
+		secret:  secret,
+		storage: s,
+		client:  &http.Client{Timeout: 10 * time.Second},
+	}
+}
+
+// parses the delivery interval as a Go duration, falling back to the default
+func WebhookIntervalFromEnv(env string) time.Duration {
+	interval, err := time.ParseDuration(env)
+	if err != nil || interval < time.Second {
+		return defaultWebhookInterval
+	}
+	return interval
+}
+
+// checks for changes every interval in the background; changes made before
+// the server started are not delivered
+func (wh *Webhook) Start(interval time.Duration) {
+	if wh.secret == "" {
+		log.Println("WARNING: WEBHOOK_SECRET is not set, webhook payloads will not be signed")
+	}
+	wh.markLatest()
+	go func() {
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+		for range ticker.C {
+			wh.check()
+		}
+	}()
+	log.Printf("Webhook enabled, checking for changes every %s\n", interval)
+}
+
+func (wh *Webhook) check() {
+	// an empty lastSent would replay the whole history, so nothing is
+	// delivered until the starting point is known
+	if !wh.ready {
+		wh.markLatest()
+		return
+	}
+	wh.deliverChanges()
+}
+
+// starts deliveries after the newest audit entry, retried on the next tick if
+// the audit log can't be read
+func (wh *Webhook) markLatest() {
+	latest, err := wh.latestChange()
+	if err != nil {
+		log.Printf("Webhook: failed to read audit log, retrying on the next check: %v\n", err)
+		return
+	}
+	wh.lastSent = latest
+	wh.ready = true
+}
+
+func (wh *Webhook) latestChange() (string, error) {
+	entries, err := wh.storage.GetAuditLog(1, 0)
+	if err != nil || len(entries) == 0 {
+		return "", err
+	}
+	return entries[0].ID, nil
+}
+
+// delivers the entries recorded since lastSent, a batch at a time, stopping at
+// the first batch that can't be delivered
+func (wh *Webhook) deliverChanges() {
+	for {
+		changes, err := wh.storage.GetAuditLogSince(wh.lastSent, webhookBatchSize)
+		if err != nil {
+			log.Printf("Webhook: failed to read audit log: %v\n", err)
+			return
+		}
+		if len(changes) == 0 || !wh.deliver(changes) {
+			return
+		}
+		wh.lastSent = changes[len(changes)-1].ID
+		if len(changes) < webhookBatchSize {
+			return
+		}
+	}
+}
+
+func (wh *Webhook) deliver(changes []storage.AuditEntry) bool {
+	summary, err := summarizePeriod(wh.storage, time.Now())
+	if err != nil {
+		log.Printf("Webhook: failed to build summary: %v\n", err)
+		return false
+	}
+	body, err := json.Marshal(WebhookPayload{Event: "expenses.changed", GeneratedAt: time.Now(), Summary: summary, Changes: changes})
+	if err != nil {
+		log.Printf("Webhook: failed to marshal payload: %v\n", err)
+		return false
+	}
+	for attempt := 0; ; attempt++ {
+		err = wh.post(body)
+		if err == nil {
+			return true
+		}
+		if attempt == len(webhookBackoff) {
+			break
+		}
+		time.Sleep(webhookBackoff[attempt])
+	}
+	// lastSent is left as-is so the next tick tries again
+	log.Printf("Webhook: delivery failed after %d attempts: %v\n", len(webhookBackoff)+1, err)
+	return false
+}
+
+func (wh *Webhook) post(body []byte) error {
+	req, err := http.NewRequest(http.MethodPost, wh.url, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	if wh.secret != "" {
+		mac := hmac.New(sha256.New, []byte(wh.secret))
+		mac.Write(body)
+		req.Header.Set("X-Signature", "sha256="+hex.EncodeToString(mac.Sum(nil)))
+	}
+	resp, err := wh.client.Do(req)
+	if err != nil {
+		return err
+	}
+	resp.Body.Close()
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		return fmt.Errorf("unexpected status %s", resp.Status)
+	}
+	return nil
+}
@@ -0,0 +1,113 @@
+package api
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/tanq16/expenseowl/internal/storage"
+)
+
+func TestWebhookDeliversEveryNewChange(t *testing.T) {
+	store, err := storage.InitializeJsonStore(storage.SystemConfig{StorageURL: t.TempDir()})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := store.AddExpense(storage.Expense{Name: "before start", Category: "Food", Amount: -1, Date: time.Now()}); err != nil {
+		t.Fatal(err)
+	}
+
+	var mu sync.Mutex
+	var payloads []WebhookPayload
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var payload WebhookPayload
+		if err := json.NewDecoder(r.Body).Decode(&payload); err != nil {
+			t.Error(err)
+		}
+		mu.Lock()
+		payloads = append(payloads, payload)
+		mu.Unlock()
+	}))
+	defer server.Close()
+
+	wh := NewWebhook(server.URL, "", store)
+	wh.lastSent, _ = wh.latestChange() // as Start does
+	for _, name := range []string{"one", "two", "three"} {
+		if err := store.AddExpense(storage.Expense{Name: name, Category: "Food", Amount: -1, Date: time.Now()}); err != nil {
+			t.Fatal(err)
+		}
+	}
+	wh.deliverChanges()
+	wh.deliverChanges() // nothing new, so nothing is posted
+
+	if len(payloads) != 1 {
+		t.Fatalf("got %d deliveries, want 1", len(payloads))
+	}
+	changes := payloads[0].Changes
+	if len(changes) != 3 {
+		t.Fatalf("delivered %d changes, want 3", len(changes))
+	}
+	for i, name := range []string{"one", "two", "three"} {
+		var diff struct {
+			After storage.Expense `json:"after"`
+		}
+		if err := json.Unmarshal(changes[i].Diff, &diff); err != nil {
+			t.Fatal(err)
+		}
+		if diff.After.Name != name {
+			t.Errorf("change %d is for %q, want %q", i, diff.After.Name, name)
+		}
+	}
+	if wh.lastSent != changes[2].ID {
+		t.Errorf("lastSent is %s, want the newest delivered entry %s", wh.lastSent, changes[2].ID)
+	}
+}
+
+// fails the first read of the audit log, like a database that is briefly down
+type flakyAuditStore struct {
+	storage.Storage
+	failures int
+}
+
+func (s *flakyAuditStore) GetAuditLog(limit, offset int) ([]storage.AuditEntry, error) {
+	if s.failures > 0 {
+		s.failures--
+		return nil, errors.New("connection refused")
+	}
+	return s.Storage.GetAuditLog(limit, offset)
+}
+
+func TestWebhookWaitsForStartingPoint(t *testing.T) {
+	store, err := storage.InitializeJsonStore(storage.SystemConfig{StorageURL: t.TempDir()})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := store.AddExpense(storage.Expense{Name: "history", Category: "Food", Amount: -1, Date: time.Now()}); err != nil {
+		t.Fatal(err)
+	}
+	var payloads []WebhookPayload
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var payload WebhookPayload
+		if err := json.NewDecoder(r.Body).Decode(&payload); err != nil {
+			t.Error(err)
+		}
+		payloads = append(payloads, payload)
+	}))
+	defer server.Close()
+
+	wh := NewWebhook(server.URL, "", &flakyAuditStore{Storage: store, failures: 1})
+	wh.markLatest() // fails, as in Start
+	wh.check()      // reads the starting point instead of replaying history
+	if err := store.AddExpense(storage.Expense{Name: "new", Category: "Food", Amount: -1, Date: time.Now()}); err != nil {
+		t.Fatal(err)
+	}
+	wh.check()
+
+	if len(payloads) != 1 || len(payloads[0].Changes) != 1 {
+		t.Fatalf("got %d deliveries, want one with the new change only", len(payloads))
+	}
+}
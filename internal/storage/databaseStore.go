@@ -5,7 +5,9 @@ import (
 	"encoding/json"
 	"fmt"
 	"log"
+	"net/url"
 	"slices"
+	"sync"
 	"time"
 
 	"github.com/google/uuid"
@@ -14,8 +16,8 @@ import (
 
 // databaseStore implements the Storage interface for PostgreSQL.
 type databaseStore struct {
-	db       *sql.DB
-	defaults map[string]string // allows reusing defaults without querying for config
+	db          *sql.DB
+	configCache configCache
 }
 
 // SQL queries as constants for reusability and clarity.
@@ -26,23 +28,26 @@ const (
 		recurring_id VARCHAR(36),
 		name VARCHAR(255) NOT NULL,
 		category VARCHAR(255) NOT NULL,
-		amount NUMERIC(10, 2) NOT NULL,
+		amount NUMERIC(15, 3) NOT NULL,
 		currency VARCHAR(3) NOT NULL,
 		date TIMESTAMPTZ NOT NULL,
-		tags TEXT
+		tags TEXT,
+		splits TEXT
 	);`
 
 	createRecurringExpensesTableSQL = `
 	CREATE TABLE IF NOT EXISTS recurring_expenses (
 		id VARCHAR(36) PRIMARY KEY,
 		name VARCHAR(255) NOT NULL,
-		amount NUMERIC(10, 2) NOT NULL,
+		amount NUMERIC(15, 3) NOT NULL,
 		currency VARCHAR(3) NOT NULL,
 		category VARCHAR(255) NOT NULL,
 		start_date TIMESTAMPTZ NOT NULL,
 		interval VARCHAR(50) NOT NULL,
 		occurrences INTEGER NOT NULL,
-		tags TEXT
+		tags TEXT,
+		skip_weekends BOOLEAN NOT NULL DEFAULT FALSE,
+		skip_holidays BOOLEAN NOT NULL DEFAULT FALSE
 	);`
 
 	createConfigTableSQL = `
@@ -50,10 +55,52 @@ const (
 		id VARCHAR(255) PRIMARY KEY DEFAULT 'default',
 		categories TEXT NOT NULL,
 		currency VARCHAR(255) NOT NULL,
-		start_date INTEGER NOT NULL
+		start_date INTEGER NOT NULL,
+		symbol_position VARCHAR(10),
+		category_colors TEXT,
+		holidays TEXT,
+		ungrouped_currencies TEXT,
+		strict_categories BOOLEAN NOT NULL DEFAULT FALSE,
+		number_locale VARCHAR(35),
+		thousands_separator VARCHAR(4),
+		decimal_separator VARCHAR(4)
 	);`
+
+	createAuditLogTableSQL = `
+	CREATE TABLE IF NOT EXISTS audit_log (
+		id VARCHAR(36) PRIMARY KEY,
+		created_at TIMESTAMPTZ NOT NULL,
+		operation VARCHAR(50) NOT NULL,
+		entity_id VARCHAR(255) NOT NULL,
+		diff TEXT NOT NULL,
+		seq BIGSERIAL
+	);`
+
+	// migrations for tables created by older releases
+	addExpenseSplitsColumnSQL  = `ALTER TABLE expenses ADD COLUMN IF NOT EXISTS splits TEXT;`
+	addCategoryColorsColumnSQL = `ALTER TABLE config ADD COLUMN IF NOT EXISTS category_colors TEXT;`
+	addSymbolPositionColumnSQL = `ALTER TABLE config ADD COLUMN IF NOT EXISTS symbol_position VARCHAR(10);`
+	addSkipWeekendsColumnSQL   = `ALTER TABLE recurring_expenses ADD COLUMN IF NOT EXISTS skip_weekends BOOLEAN NOT NULL DEFAULT FALSE;`
+	addSkipHolidaysColumnSQL   = `ALTER TABLE recurring_expenses ADD COLUMN IF NOT EXISTS skip_holidays BOOLEAN NOT NULL DEFAULT FALSE;`
+	addHolidaysColumnSQL       = `ALTER TABLE config ADD COLUMN IF NOT EXISTS holidays TEXT;`
+	addUngroupedColumnSQL      = `ALTER TABLE config ADD COLUMN IF NOT EXISTS ungrouped_currencies TEXT;`
+	addStrictCategoriesSQL     = `ALTER TABLE config ADD COLUMN IF NOT EXISTS strict_categories BOOLEAN NOT NULL DEFAULT FALSE;`
+	addNumberLocaleColumnSQL   = `ALTER TABLE config ADD COLUMN IF NOT EXISTS number_locale VARCHAR(35);`
+	addSeparatorColumnsSQL     = `
+	ALTER TABLE config ADD COLUMN IF NOT EXISTS thousands_separator VARCHAR(4);
+	ALTER TABLE config ADD COLUMN IF NOT EXISTS decimal_separator VARCHAR(4);`
+	// seq orders entries by commit, see insertAuditEntry
+	addAuditSeqColumnSQL = `
+	ALTER TABLE audit_log ADD COLUMN IF NOT EXISTS seq BIGSERIAL;
+	CREATE UNIQUE INDEX IF NOT EXISTS audit_log_seq_idx ON audit_log (seq);`
+	amountColumnTypeSQL  = `SELECT numeric_precision, numeric_scale FROM information_schema.columns WHERE table_schema = current_schema() AND table_name = $1 AND column_name = 'amount'`
+	widenAmountColumnSQL = `ALTER TABLE %s ALTER COLUMN amount TYPE NUMERIC(15, 3);`
 )
 
+// the precision and scale amount columns are migrated to, keeping a third
+// decimal for currencies that use one
+const amountPrecision, amountScale = 15, 3
+
 func InitializePostgresStore(baseConfig SystemConfig) (Storage, error) {
 	dbURL := makeDBURL(baseConfig)
 	db, err := sql.Open("postgres", dbURL)
@@ -68,19 +115,71 @@ func InitializePostgresStore(baseConfig SystemConfig) (Storage, error) {
 	if err := createTables(db); err != nil {
 		return nil, fmt.Errorf("failed to create database tables: %v", err)
 	}
-	return &databaseStore{db: db, defaults: map[string]string{}}, nil
+	return &databaseStore{db: db}, nil
 }
 
 func makeDBURL(baseConfig SystemConfig) string {
-	return fmt.Sprintf("postgres://%s:%s@%s?sslmode=%s", baseConfig.StorageUser, baseConfig.StoragePass, baseConfig.StorageURL, baseConfig.StorageSSL)
+	dbURL := fmt.Sprintf("postgres://%s:%s@%s?sslmode=%s", baseConfig.StorageUser, baseConfig.StoragePass, baseConfig.StorageURL, baseConfig.StorageSSL)
+	// certificate paths are only added when set so libpq defaults still apply
+	for _, param := range []struct{ key, path string }{
+		{"sslrootcert", baseConfig.StorageSSLRootCert},
+		{"sslcert", baseConfig.StorageSSLCert},
+		{"sslkey", baseConfig.StorageSSLKey},
+	} {
+		if param.path != "" {
+			dbURL += "&" + param.key + "=" + url.QueryEscape(param.path)
+		}
+	}
+	return dbURL
 }
 
 func createTables(db *sql.DB) error {
-	for _, query := range []string{createExpensesTableSQL, createRecurringExpensesTableSQL, createConfigTableSQL} {
+	for _, query := range []string{createExpensesTableSQL, createRecurringExpensesTableSQL, createConfigTableSQL, createAuditLogTableSQL, addExpenseSplitsColumnSQL, addCategoryColorsColumnSQL, addSymbolPositionColumnSQL, addSkipWeekendsColumnSQL, addSkipHolidaysColumnSQL, addHolidaysColumnSQL, addUngroupedColumnSQL, addStrictCategoriesSQL, addNumberLocaleColumnSQL, addSeparatorColumnsSQL, addAuditSeqColumnSQL} {
 		if _, err := db.Exec(query); err != nil {
 			return err
 		}
 	}
+	return widenAmountColumns(db)
+}
+
+// only alters amount columns that aren't NUMERIC(15, 3) yet, since ALTER
+// COLUMN TYPE takes an exclusive lock on the table even when the type is
+// unchanged, and rewrites it when the scale changes
+func widenAmountColumns(db *sql.DB) error {
+	for _, table := range []string{"expenses", "recurring_expenses"} {
+		var precision, scale sql.NullInt64
+		if err := db.QueryRow(amountColumnTypeSQL, table).Scan(&precision, &scale); err != nil {
+			return fmt.Errorf("failed to check the amount column of %s: %v", table, err)
+		}
+		if precision.Int64 == amountPrecision && scale.Int64 == amountScale {
+			continue
+		}
+		if _, err := db.Exec(fmt.Sprintf(widenAmountColumnSQL, table)); err != nil {
+			return fmt.Errorf("failed to widen the amount column of %s: %v", table, err)
+		}
+	}
+	return nil
+}
+
+// satisfied by both *sql.DB and *sql.Tx
+type execer interface {
+	Exec(query string, args ...any) (sql.Result, error)
+}
+
+// key of the advisory lock that serializes audit log writers
+const auditLockKey = 0x6f776c61756474 // "owlaudt"
+
+// the advisory lock is held until the transaction ends, so seq values are
+// taken in commit order and a reader paging on seq never sees a gap that a
+// slower transaction fills in later
+func insertAuditEntry(ex execer, entry AuditEntry) error {
+	query := `
+		INSERT INTO audit_log (id, created_at, operation, entity_id, diff)
+		SELECT $1, $2::timestamptz, $3, $4, $5 FROM (SELECT pg_advisory_xact_lock($6)) AS serialized
+	`
+	if _, err := ex.Exec(query, entry.ID, entry.Timestamp, entry.Operation, entry.EntityID, string(entry.Diff), auditLockKey); err != nil {
+		return fmt.Errorf("failed to write audit entry: %v", err)
+	}
 	return nil
 }
 
@@ -88,87 +187,421 @@ func (s *databaseStore) Close() error {
 	return s.db.Close()
 }
 
-func (s *databaseStore) saveConfig(config *Config) error {
+func (s *databaseStore) Status() (StorageStatus, error) {
+	status := StorageStatus{Backend: BackendTypePostgres}
+	if err := s.db.Ping(); err != nil {
+		return status, fmt.Errorf("failed to ping PostgreSQL database: %v", err)
+	}
+	return status, nil
+}
+
+func (s *databaseStore) Counts() (StorageCounts, error) {
+	var counts StorageCounts
+	query := `SELECT (SELECT COUNT(*) FROM expenses), (SELECT COUNT(*) FROM recurring_expenses)`
+	if err := s.db.QueryRow(query).Scan(&counts.Expenses, &counts.RecurringExpenses); err != nil {
+		return StorageCounts{}, fmt.Errorf("failed to count rows: %v", err)
+	}
+	return counts, nil
+}
+
+func (s *databaseStore) saveConfig(ex execer, config *Config) error {
 	categoriesJSON, err := json.Marshal(config.Categories)
 	if err != nil {
 		return fmt.Errorf("failed to marshal categories: %v", err)
 	}
+	colorsJSON, err := json.Marshal(config.CategoryColors)
+	if err != nil {
+		return fmt.Errorf("failed to marshal category colors: %v", err)
+	}
+	holidaysJSON, err := json.Marshal(config.Holidays)
+	if err != nil {
+		return fmt.Errorf("failed to marshal holidays: %v", err)
+	}
+	ungroupedJSON, err := json.Marshal(config.UngroupedCurrencies)
+	if err != nil {
+		return fmt.Errorf("failed to marshal ungrouped currencies: %v", err)
+	}
 	query := `
-		INSERT INTO config (id, categories, currency, start_date)
-		VALUES ('default', $1, $2, $3)
+		INSERT INTO config (id, categories, currency, start_date, symbol_position, category_colors, holidays, ungrouped_currencies, strict_categories, number_locale, thousands_separator, decimal_separator)
+		VALUES ('default', $1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11)
 		ON CONFLICT (id) DO UPDATE SET
 			categories = EXCLUDED.categories,
 			currency = EXCLUDED.currency,
-			start_date = EXCLUDED.start_date;
+			start_date = EXCLUDED.start_date,
+			symbol_position = EXCLUDED.symbol_position,
+			category_colors = EXCLUDED.category_colors,
+			holidays = EXCLUDED.holidays,
+			ungrouped_currencies = EXCLUDED.ungrouped_currencies,
+			strict_categories = EXCLUDED.strict_categories,
+			number_locale = EXCLUDED.number_locale,
+			thousands_separator = EXCLUDED.thousands_separator,
+			decimal_separator = EXCLUDED.decimal_separator;
 	`
-	_, err = s.db.Exec(query, string(categoriesJSON), config.Currency, config.StartDate)
-	s.defaults["currency"] = config.Currency
-	s.defaults["start_date"] = fmt.Sprintf("%d", config.StartDate)
-	return err
+	if _, err = ex.Exec(query, string(categoriesJSON), config.Currency, config.StartDate, config.SymbolPosition, string(colorsJSON), string(holidaysJSON), string(ungroupedJSON), config.StrictCategories, config.NumberLocale, config.ThousandsSeparator, config.DecimalSeparator); err != nil {
+		return err
+	}
+	return nil
 }
 
-func (s *databaseStore) updateConfig(updater func(c *Config) error) error {
-	config, err := s.GetConfig()
+// reads the config within tx, locking its row until the transaction ends; the
+// base config is returned if none has been saved yet
+func selectConfigForUpdate(tx *sql.Tx) (*Config, error) {
+	query := `SELECT categories, currency, start_date, symbol_position, category_colors, holidays, ungrouped_currencies, strict_categories, number_locale, thousands_separator, decimal_separator FROM config WHERE id = 'default' FOR UPDATE`
+	config, err := scanConfig(tx.QueryRow(query))
+	if err == sql.ErrNoRows {
+		config = &Config{}
+		config.SetBaseConfig()
+	} else if err != nil {
+		return nil, fmt.Errorf("failed to get config from db: %v", err)
+	}
+	return config, nil
+}
+
+// reads, updates, and saves the config in one transaction, locking the row so
+// concurrent updates can't overwrite each other
+func (s *databaseStore) updateConfig(operation string, updater func(c *Config) error) error {
+	tx, err := s.db.Begin()
+	if err != nil {
+		return fmt.Errorf("failed to begin transaction: %v", err)
+	}
+	defer tx.Rollback()
+	config, err := selectConfigForUpdate(tx)
 	if err != nil {
 		return err
 	}
+	before := config.settings()
 	if err := updater(config); err != nil {
 		return err
 	}
-	return s.saveConfig(config)
+	after := config.settings()
+	if after.equal(before) {
+		return nil
+	}
+	if err := s.saveConfig(tx, config); err != nil {
+		return err
+	}
+	if err := insertAuditEntry(tx, newAuditEntry(operation, configEntityID, before, after)); err != nil {
+		return err
+	}
+	return s.commitConfig(tx)
 }
 
-func (s *databaseStore) GetConfig() (*Config, error) {
-	query := `SELECT categories, currency, start_date FROM config WHERE id = 'default'`
-	var categoriesStr, currency string
-	var startDate int
-	err := s.db.QueryRow(query).Scan(&categoriesStr, &currency, &startDate)
+// how long GetConfig reuses a config read from the database; writes through
+// this store drop it right away, so this only bounds how long changes made by
+// another instance sharing the database can go unseen
+const configCacheTTL = 5 * time.Second
+
+// the last config read from the database, with or without its recurring
+// expenses depending on whether GetConfig or getConfigCore loaded it
+type configCache struct {
+	mu           sync.Mutex
+	config       *Config
+	hasRecurring bool
+	expires      time.Time
+	generation   uint64 // bumped by invalidate so loads started before a write aren't cached
+}
+
+// returns a copy of the cached config, or nil if there is none with the
+// recurring expenses when withRecurring is set, along with the generation to
+// pass to set once the config has been loaded
+func (c *configCache) get(withRecurring bool) (*Config, uint64) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.config == nil || time.Now().After(c.expires) || (withRecurring && !c.hasRecurring) {
+		return nil, c.generation
+	}
+	return c.config.clone(), c.generation
+}
+
+func (c *configCache) set(config *Config, hasRecurring bool, generation uint64) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if generation != c.generation {
+		return
+	}
+	c.config = config.clone()
+	c.hasRecurring = hasRecurring
+	c.expires = time.Now().Add(configCacheTTL)
+}
 
+func (c *configCache) invalidate() {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.config = nil
+	c.generation++
+}
+
+// commits a transaction that wrote the config or recurring expenses and drops
+// the cached config, which only happens after the commit so a concurrent
+// GetConfig can't cache what it read before it
+func (s *databaseStore) commitConfig(tx *sql.Tx) error {
+	if err := tx.Commit(); err != nil {
+		return err
+	}
+	s.configCache.invalidate()
+	return nil
+}
+
+// returns the configured currency through the config cache, so it follows
+// committed changes from any instance; empty if the config can't be read,
+// which resolveCurrency treats as the default currency
+func (s *databaseStore) configuredCurrency() string {
+	config, err := s.getConfigCore()
 	if err != nil {
-		if err == sql.ErrNoRows {
-			config := &Config{}
-			config.SetBaseConfig()
-			if err := s.saveConfig(config); err != nil {
-				return nil, fmt.Errorf("failed to save initial default config: %v", err)
-			}
-			return config, nil
-		}
-		return nil, fmt.Errorf("failed to get config from db: %v", err)
+		log.Printf("Failed to read configured currency: %v\n", err)
+		return ""
 	}
+	return config.Currency
+}
 
+// scans the settings stored in the config table, without recurring expenses
+func scanConfig(scanner interface{ Scan(...any) error }) (*Config, error) {
 	var config Config
-	config.Currency = currency
-	config.StartDate = startDate
+	var categoriesStr string
+	var symbolPosition, colorsStr, holidaysStr, ungroupedStr, numberLocale, thousands, decimal sql.NullString
+	if err := scanner.Scan(&categoriesStr, &config.Currency, &config.StartDate, &symbolPosition, &colorsStr, &holidaysStr, &ungroupedStr, &config.StrictCategories, &numberLocale, &thousands, &decimal); err != nil {
+		return nil, err
+	}
+	config.SymbolPosition = symbolPosition.String
+	config.NumberLocale = numberLocale.String
+	config.ThousandsSeparator = thousands.String
+	config.DecimalSeparator = decimal.String
 	if err := json.Unmarshal([]byte(categoriesStr), &config.Categories); err != nil {
 		return nil, fmt.Errorf("failed to parse categories from db: %v", err)
 	}
+	if colorsStr.Valid && colorsStr.String != "" {
+		if err := json.Unmarshal([]byte(colorsStr.String), &config.CategoryColors); err != nil {
+			return nil, fmt.Errorf("failed to parse category colors from db: %v", err)
+		}
+	}
+	if holidaysStr.Valid && holidaysStr.String != "" {
+		if err := json.Unmarshal([]byte(holidaysStr.String), &config.Holidays); err != nil {
+			return nil, fmt.Errorf("failed to parse holidays from db: %v", err)
+		}
+	}
+	if ungroupedStr.Valid && ungroupedStr.String != "" {
+		if err := json.Unmarshal([]byte(ungroupedStr.String), &config.UngroupedCurrencies); err != nil {
+			return nil, fmt.Errorf("failed to parse ungrouped currencies from db: %v", err)
+		}
+	}
+	return &config, nil
+}
 
+func (s *databaseStore) GetConfig() (*Config, error) {
+	cached, generation := s.configCache.get(true)
+	if cached != nil {
+		return cached, nil
+	}
+	config, err := s.getConfigCore()
+	if err != nil {
+		return nil, err
+	}
 	recurring, err := s.GetRecurringExpenses()
 	if err != nil {
 		return nil, fmt.Errorf("failed to get recurring expenses for config: %v", err)
 	}
 	config.RecurringExpenses = recurring
+	s.configCache.set(config, true, generation)
 
-	return &config, nil
+	return config, nil
+}
+
+// the config without recurring expenses, for reads that only need settings
+// and shouldn't pay for the recurring_expenses query; it shares the cache with
+// GetConfig, which then only has to add the recurring expenses
+func (s *databaseStore) getConfigCore() (*Config, error) {
+	cached, generation := s.configCache.get(false)
+	if cached != nil {
+		return cached, nil
+	}
+	query := `SELECT categories, currency, start_date, symbol_position, category_colors, holidays, ungrouped_currencies, strict_categories, number_locale, thousands_separator, decimal_separator FROM config WHERE id = 'default'`
+	config, err := scanConfig(s.db.QueryRow(query))
+
+	if err != nil {
+		if err == sql.ErrNoRows {
+			config := &Config{}
+			config.SetBaseConfig()
+			if err := s.saveConfig(s.db, config); err != nil {
+				return nil, fmt.Errorf("failed to save initial default config: %v", err)
+			}
+			return config, nil
+		}
+		return nil, fmt.Errorf("failed to get config from db: %v", err)
+	}
+	s.configCache.set(config, false, generation)
+	return config, nil
 }
 
 func (s *databaseStore) GetCategories() ([]string, error) {
-	config, err := s.GetConfig()
+	config, err := s.getConfigCore()
 	if err != nil {
 		return nil, err
 	}
 	return config.Categories, nil
 }
 
+func (s *databaseStore) GetUsedCategories() ([]string, error) {
+	rows, err := s.db.Query(`SELECT DISTINCT category FROM expenses ORDER BY category`)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query used categories: %v", err)
+	}
+	defer rows.Close()
+	used := []string{}
+	for rows.Next() {
+		var category string
+		if err := rows.Scan(&category); err != nil {
+			return nil, fmt.Errorf("failed to scan used category: %v", err)
+		}
+		used = append(used, category)
+	}
+	return used, nil
+}
+
 func (s *databaseStore) UpdateCategories(categories []string) error {
-	return s.updateConfig(func(c *Config) error {
+	return s.updateConfig("update_categories", func(c *Config) error {
 		c.Categories = categories
 		return nil
 	})
 }
 
+func (s *databaseStore) RenameCategory(oldName, newName string) error {
+	newName, err := ValidateCategory(newName)
+	if err != nil {
+		return err
+	}
+	return s.reassignCategories("rename_category", []string{oldName}, newName, func(c *Config) error {
+		index := slices.Index(c.Categories, oldName)
+		if index == -1 {
+			return fmt.Errorf("category %s %w", oldName, ErrNotFound)
+		}
+		if slices.Contains(c.Categories, newName) {
+			return invalidf("category %s already exists", newName)
+		}
+		c.Categories[index] = newName
+		return nil
+	})
+}
+
+func (s *databaseStore) MergeCategories(sources []string, target string) error {
+	target, err := ValidateCategory(target)
+	if err != nil {
+		return err
+	}
+	return s.reassignCategories("merge_categories", sources, target, func(c *Config) error {
+		merged, err := mergeCategoryList(c.Categories, sources, target)
+		if err != nil {
+			return err
+		}
+		c.Categories = merged
+		return nil
+	})
+}
+
+// updates the category list with updateList, then moves colors, expenses and
+// recurring expenses from the source categories to target and records the
+// audit entry, all in one transaction that holds the config row lock
+func (s *databaseStore) reassignCategories(operation string, sources []string, target string, updateList func(c *Config) error) error {
+	tx, err := s.db.Begin()
+	if err != nil {
+		return fmt.Errorf("failed to begin transaction: %v", err)
+	}
+	defer tx.Rollback()
+	config, err := selectConfigForUpdate(tx)
+	if err != nil {
+		return err
+	}
+	before := config.settings()
+	if err := updateList(config); err != nil {
+		return err
+	}
+	config.reassignCategoryColors(sources, target)
+	if err := s.saveConfig(tx, config); err != nil {
+		return fmt.Errorf("failed to update categories: %v", err)
+	}
+	if _, err := tx.Exec(`UPDATE expenses SET category = $1 WHERE category = ANY($2)`, target, pq.Array(sources)); err != nil {
+		return fmt.Errorf("failed to update expense categories: %v", err)
+	}
+	if _, err := tx.Exec(`UPDATE recurring_expenses SET category = $1 WHERE category = ANY($2)`, target, pq.Array(sources)); err != nil {
+		return fmt.Errorf("failed to update recurring expense categories: %v", err)
+	}
+
+	// splits are stored as JSON, so they are rewritten row by row
+	rows, err := tx.Query(`SELECT id, splits FROM expenses WHERE splits IS NOT NULL`)
+	if err != nil {
+		return fmt.Errorf("failed to query expense splits: %v", err)
+	}
+	updatedSplits := make(map[string]sql.NullString)
+	for rows.Next() {
+		var expense Expense
+		var splitsStr string
+		if err := rows.Scan(&expense.ID, &splitsStr); err != nil {
+			rows.Close()
+			return fmt.Errorf("failed to scan expense splits: %v", err)
+		}
+		if err := json.Unmarshal([]byte(splitsStr), &expense.Splits); err != nil {
+			rows.Close()
+			return fmt.Errorf("failed to parse splits for expense %s: %v", expense.ID, err)
+		}
+		if expense.reassignCategory(sources, target) {
+			if updatedSplits[expense.ID], err = marshalSplits(expense.Splits); err != nil {
+				rows.Close()
+				return err
+			}
+		}
+	}
+	rows.Close()
+	for id, splitsJSON := range updatedSplits {
+		if _, err := tx.Exec(`UPDATE expenses SET splits = $1 WHERE id = $2`, splitsJSON, id); err != nil {
+			return fmt.Errorf("failed to update splits for expense %s: %v", id, err)
+		}
+	}
+	if err := insertAuditEntry(tx, newAuditEntry(operation, configEntityID, before, config.settings())); err != nil {
+		return err
+	}
+	return s.commitConfig(tx)
+}
+
+func (s *databaseStore) AddCategory(name string) error {
+	name, err := ValidateCategory(name)
+	if err != nil {
+		return err
+	}
+	return s.updateConfig("add_category", func(c *Config) error {
+		if !slices.Contains(c.Categories, name) {
+			c.Categories = append(c.Categories, name)
+		}
+		return nil
+	})
+}
+
+func (s *databaseStore) RemoveCategory(name string) error {
+	return s.updateConfig("remove_category", func(c *Config) error {
+		c.Categories = slices.DeleteFunc(c.Categories, func(category string) bool { return category == name })
+		return nil
+	})
+}
+
+func (s *databaseStore) GetCategoryColors() (map[string]string, error) {
+	config, err := s.getConfigCore()
+	if err != nil {
+		return nil, err
+	}
+	return config.resolvedCategoryColors(), nil
+}
+
+func (s *databaseStore) UpdateCategoryColors(colors map[string]string) error {
+	colors, err := validateCategoryColors(colors)
+	if err != nil {
+		return err
+	}
+	return s.updateConfig("update_category_colors", func(c *Config) error {
+		c.CategoryColors = colors
+		return nil
+	})
+}
+
 func (s *databaseStore) GetCurrency() (string, error) {
-	config, err := s.GetConfig()
+	config, err := s.getConfigCore()
 	if err != nil {
 		return "", err
 	}
@@ -179,14 +612,14 @@ func (s *databaseStore) UpdateCurrency(currency string) error {
 	if !slices.Contains(SupportedCurrencies, currency) {
 		return fmt.Errorf("invalid currency: %s", currency)
 	}
-	return s.updateConfig(func(c *Config) error {
+	return s.updateConfig("update_currency", func(c *Config) error {
 		c.Currency = currency
 		return nil
 	})
 }
 
 func (s *databaseStore) GetStartDate() (int, error) {
-	config, err := s.GetConfig()
+	config, err := s.getConfigCore()
 	if err != nil {
 		return 0, err
 	}
@@ -197,40 +630,201 @@ func (s *databaseStore) UpdateStartDate(startDate int) error {
 	if startDate < 1 || startDate > 31 {
 		return fmt.Errorf("invalid start date: %d", startDate)
 	}
-	return s.updateConfig(func(c *Config) error {
+	return s.updateConfig("update_start_date", func(c *Config) error {
 		c.StartDate = startDate
 		return nil
 	})
 }
 
+func (s *databaseStore) UpdateSymbolPosition(position string) error {
+	if !slices.Contains(SymbolPositions, position) {
+		return fmt.Errorf("invalid symbol position: %s", position)
+	}
+	return s.updateConfig("update_symbol_position", func(c *Config) error {
+		c.SymbolPosition = position
+		return nil
+	})
+}
+
+func (s *databaseStore) UpdateHolidays(holidays []string) error {
+	holidays, err := validateHolidays(holidays)
+	if err != nil {
+		return err
+	}
+	return s.updateConfig("update_holidays", func(c *Config) error {
+		c.Holidays = holidays
+		return nil
+	})
+}
+
+func (s *databaseStore) UpdateStrictCategories(strict bool) error {
+	return s.updateConfig("update_strict_categories", func(c *Config) error {
+		c.StrictCategories = strict
+		return nil
+	})
+}
+
+func (s *databaseStore) UpdateUngroupedCurrencies(currencies []string) error {
+	currencies, err := validateUngroupedCurrencies(currencies)
+	if err != nil {
+		return err
+	}
+	return s.updateConfig("update_ungrouped_currencies", func(c *Config) error {
+		c.UngroupedCurrencies = currencies
+		return nil
+	})
+}
+
+func (s *databaseStore) UpdateNumberLocale(locale string) error {
+	locale, err := validateNumberLocale(locale)
+	if err != nil {
+		return err
+	}
+	return s.updateConfig("update_number_locale", func(c *Config) error {
+		c.NumberLocale = locale
+		return nil
+	})
+}
+
+func (s *databaseStore) UpdateSeparators(thousands, decimal string) error {
+	if err := validateSeparators(thousands, decimal); err != nil {
+		return err
+	}
+	return s.updateConfig("update_separators", func(c *Config) error {
+		c.ThousandsSeparator = thousands
+		c.DecimalSeparator = decimal
+		return nil
+	})
+}
+
+// returns the configured holidays for recurring generation
+func (s *databaseStore) holidays() ([]string, error) {
+	var holidaysStr sql.NullString
+	err := s.db.QueryRow(`SELECT holidays FROM config WHERE id = 'default'`).Scan(&holidaysStr)
+	if err != nil && err != sql.ErrNoRows {
+		return nil, fmt.Errorf("failed to get holidays from db: %v", err)
+	}
+	if !holidaysStr.Valid || holidaysStr.String == "" {
+		return nil, nil
+	}
+	var holidays []string
+	if err := json.Unmarshal([]byte(holidaysStr.String), &holidays); err != nil {
+		return nil, fmt.Errorf("failed to parse holidays from db: %v", err)
+	}
+	return holidays, nil
+}
+
 func scanExpense(scanner interface{ Scan(...any) error }) (Expense, error) {
 	var expense Expense
-	var tagsStr sql.NullString
+	var tagsStr, splitsStr sql.NullString
 	var recurringID sql.NullString
-	err := scanner.Scan(&expense.ID, &recurringID, &expense.Name, &expense.Category, &expense.Amount, &expense.Date, &tagsStr)
+	// the columns are NOT NULL, but rows edited by hand may still hold NULLs
+	var amount sql.NullFloat64
+	var date sql.NullTime
+	err := scanner.Scan(&expense.ID, &recurringID, &expense.Name, &expense.Category, &amount, &expense.Currency, &date, &tagsStr, &splitsStr)
 	if err != nil {
 		return Expense{}, err
 	}
 	if recurringID.Valid {
 		expense.RecurringID = recurringID.String
 	}
+	if !amount.Valid || !date.Valid {
+		log.Printf("WARNING: expense %s has a NULL amount or date, using zero instead\n", expense.ID)
+	}
+	expense.Amount = amount.Float64
+	expense.Date = date.Time
 	if tagsStr.Valid && tagsStr.String != "" {
 		if err := json.Unmarshal([]byte(tagsStr.String), &expense.Tags); err != nil {
 			return Expense{}, fmt.Errorf("failed to parse tags for expense %s: %v", expense.ID, err)
 		}
 	}
+	if splitsStr.Valid && splitsStr.String != "" {
+		if err := json.Unmarshal([]byte(splitsStr.String), &expense.Splits); err != nil {
+			return Expense{}, fmt.Errorf("failed to parse splits for expense %s: %v", expense.ID, err)
+		}
+	}
+	return expense, nil
+}
+
+// splits are stored as NULL when absent to keep unsplit rows unchanged
+func marshalSplits(splits []ExpenseSplit) (sql.NullString, error) {
+	if len(splits) == 0 {
+		return sql.NullString{}, nil
+	}
+	splitsJSON, err := json.Marshal(splits)
+	if err != nil {
+		return sql.NullString{}, err
+	}
+	return sql.NullString{String: string(splitsJSON), Valid: true}, nil
+}
+
+func (s *databaseStore) GetAllExpenses() ([]Expense, error) {
+	query := `SELECT id, recurring_id, name, category, amount, currency, date, tags, splits FROM expenses ORDER BY date DESC`
+	rows, err := s.db.Query(query)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query expenses: %v", err)
+	}
+	defer rows.Close()
+
+	var expenses []Expense
+	for rows.Next() {
+		expense, err := scanExpense(rows)
+		if err != nil {
+			return nil, fmt.Errorf("failed to scan expense: %v", err)
+		}
+		expenses = append(expenses, expense)
+	}
+	return expenses, nil
+}
+
+// scans rows one at a time instead of collecting them, so large tables can be
+// streamed without loading every expense into memory
+func (s *databaseStore) EachExpense(fn func(Expense) error) error {
+	query := `SELECT id, recurring_id, name, category, amount, currency, date, tags, splits FROM expenses ORDER BY date DESC`
+	rows, err := s.db.Query(query)
+	if err != nil {
+		return fmt.Errorf("failed to query expenses: %v", err)
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		expense, err := scanExpense(rows)
+		if err != nil {
+			return fmt.Errorf("failed to scan expense: %v", err)
+		}
+		if err := fn(expense); err != nil {
+			return err
+		}
+	}
+	if err := rows.Err(); err != nil {
+		return fmt.Errorf("failed to iterate expenses: %v", err)
+	}
+	return nil
+}
+
+func (s *databaseStore) GetExpense(id string) (Expense, error) {
+	query := `SELECT id, recurring_id, name, category, amount, currency, date, tags, splits FROM expenses WHERE id = $1`
+	expense, err := scanExpense(s.db.QueryRow(query, id))
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return Expense{}, fmt.Errorf("expense with ID %s %w", id, ErrNotFound)
+		}
+		return Expense{}, fmt.Errorf("failed to get expense: %v", err)
+	}
 	return expense, nil
 }
 
-func (s *databaseStore) GetAllExpenses() ([]Expense, error) {
-	query := `SELECT id, recurring_id, name, category, amount, date, tags FROM expenses ORDER BY date DESC`
-	rows, err := s.db.Query(query)
+func (s *databaseStore) GetExpensesByIDs(ids []string) ([]Expense, error) {
+	expenses := []Expense{}
+	if len(ids) == 0 {
+		return expenses, nil
+	}
+	query := `SELECT id, recurring_id, name, category, amount, currency, date, tags, splits FROM expenses WHERE id = ANY($1)`
+	rows, err := s.db.Query(query, pq.Array(ids))
 	if err != nil {
 		return nil, fmt.Errorf("failed to query expenses: %v", err)
 	}
 	defer rows.Close()
-
-	var expenses []Expense
 	for rows.Next() {
 		expense, err := scanExpense(rows)
 		if err != nil {
@@ -241,25 +835,63 @@ func (s *databaseStore) GetAllExpenses() ([]Expense, error) {
 	return expenses, nil
 }
 
-func (s *databaseStore) GetExpense(id string) (Expense, error) {
-	query := `SELECT id, recurring_id, name, category, amount, date, tags FROM expenses WHERE id = $1`
-	expense, err := scanExpense(s.db.QueryRow(query, id))
+func (s *databaseStore) GetExpensesByRecurringID(id string) ([]Expense, error) {
+	query := `SELECT id, recurring_id, name, category, amount, currency, date, tags, splits FROM expenses WHERE recurring_id = $1 ORDER BY date`
+	rows, err := s.db.Query(query, id)
 	if err != nil {
-		if err == sql.ErrNoRows {
-			return Expense{}, fmt.Errorf("expense with ID %s not found", id)
+		return nil, fmt.Errorf("failed to query recurring expense instances: %v", err)
+	}
+	defer rows.Close()
+	expenses := []Expense{}
+	for rows.Next() {
+		expense, err := scanExpense(rows)
+		if err != nil {
+			return nil, fmt.Errorf("failed to scan expense: %v", err)
 		}
-		return Expense{}, fmt.Errorf("failed to get expense: %v", err)
+		expenses = append(expenses, expense)
 	}
-	return expense, nil
+	return expenses, nil
 }
 
 func (s *databaseStore) AddExpense(expense Expense) error {
+	if err := s.checkCategories(expense); err != nil {
+		return err
+	}
+	tx, err := s.db.Begin()
+	if err != nil {
+		return fmt.Errorf("failed to begin transaction: %v", err)
+	}
+	defer tx.Rollback()
+	if err := s.insertExpense(tx, &expense); err != nil {
+		return err
+	}
+	if err := insertAuditEntry(tx, newAuditEntry("add_expense", expense.ID, nil, expense)); err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+// rejects expenses in categories missing from the config when strict
+// categories are on
+func (s *databaseStore) checkCategories(expenses ...Expense) error {
+	config, err := s.getConfigCore()
+	if err != nil {
+		return err
+	}
+	for _, expense := range expenses {
+		if err := config.CheckExpenseCategories(expense); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// fills in defaults for the ID, currency, and date, then inserts the expense
+func (s *databaseStore) insertExpense(ex execer, expense *Expense) error {
 	if expense.ID == "" {
 		expense.ID = uuid.New().String()
 	}
-	if expense.Currency == "" {
-		expense.Currency = s.defaults["currency"]
-	}
+	expense.Currency = resolveCurrency(expense.Currency, s.configuredCurrency())
 	if expense.Date.IsZero() {
 		expense.Date = time.Now()
 	}
@@ -267,87 +899,170 @@ func (s *databaseStore) AddExpense(expense Expense) error {
 	if err != nil {
 		return err
 	}
+	splitsJSON, err := marshalSplits(expense.Splits)
+	if err != nil {
+		return err
+	}
 	query := `
-		INSERT INTO expenses (id, recurring_id, name, category, amount, currency, date, tags)
-		VALUES ($1, $2, $3, $4, $5, $6, $7, $8)
+		INSERT INTO expenses (id, recurring_id, name, category, amount, currency, date, tags, splits)
+		VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9)
 	`
-	_, err = s.db.Exec(query, expense.ID, expense.RecurringID, expense.Name, expense.Category, expense.Amount, expense.Currency, expense.Date, string(tagsJSON))
+	_, err = ex.Exec(query, expense.ID, expense.RecurringID, expense.Name, expense.Category, expense.Amount, expense.Currency, expense.Date, string(tagsJSON), splitsJSON)
 	return err
 }
 
 func (s *databaseStore) UpdateExpense(id string, expense Expense) error {
+	_, err := s.updateExpense(id, func(stored *Expense) error {
+		*stored = expense
+		return nil
+	})
+	return err
+}
+
+func (s *databaseStore) PatchExpense(id string, apply func(*Expense) error) (Expense, error) {
+	return s.updateExpense(id, apply)
+}
+
+// applies the change while holding the row lock, so concurrent edits of the
+// same expense are serialized
+func (s *databaseStore) updateExpense(id string, apply func(*Expense) error) (Expense, error) {
+	// TODO: revisit to maybe remove this later, might not be a good default for update
+	currency := s.configuredCurrency()
+	tx, err := s.db.Begin()
+	if err != nil {
+		return Expense{}, fmt.Errorf("failed to begin transaction: %v", err)
+	}
+	defer tx.Rollback()
+	selectQuery := `SELECT id, recurring_id, name, category, amount, currency, date, tags, splits FROM expenses WHERE id = $1 FOR UPDATE`
+	before, err := scanExpense(tx.QueryRow(selectQuery, id))
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return Expense{}, fmt.Errorf("expense with ID %s %w", id, ErrNotFound)
+		}
+		return Expense{}, fmt.Errorf("failed to get expense: %v", err)
+	}
+	expense := before
+	expense.Tags = slices.Clone(before.Tags)
+	expense.Splits = slices.Clone(before.Splits)
+	if err := apply(&expense); err != nil {
+		return Expense{}, err
+	}
+	if err := s.checkCategories(expense); err != nil {
+		return Expense{}, err
+	}
+	expense.ID = id
+	expense.Currency = resolveCurrency(expense.Currency, currency)
 	tagsJSON, err := json.Marshal(expense.Tags)
 	if err != nil {
-		return err
+		return Expense{}, err
 	}
-	// TODO: revisit to maybe remove this later, might not be a good default for update
-	if expense.Currency == "" {
-		expense.Currency = s.defaults["currency"]
+	splitsJSON, err := marshalSplits(expense.Splits)
+	if err != nil {
+		return Expense{}, err
 	}
 	query := `
 		UPDATE expenses
-		SET name = $1, category = $2, amount = $3, currency = $4, date = $5, tags = $6, recurring_id = $7
-		WHERE id = $8
+		SET name = $1, category = $2, amount = $3, currency = $4, date = $5, tags = $6, recurring_id = $7, splits = $8
+		WHERE id = $9
 	`
-	result, err := s.db.Exec(query, expense.Name, expense.Category, expense.Amount, expense.Currency, expense.Date, string(tagsJSON), expense.RecurringID, id)
+	_, err = tx.Exec(query, expense.Name, expense.Category, expense.Amount, expense.Currency, expense.Date, string(tagsJSON), expense.RecurringID, splitsJSON, id)
 	if err != nil {
-		return fmt.Errorf("failed to update expense: %v", err)
+		return Expense{}, fmt.Errorf("failed to update expense: %v", err)
 	}
-	rowsAffected, err := result.RowsAffected()
-	if err != nil {
-		return fmt.Errorf("failed to get rows affected: %v", err)
+	if err := insertAuditEntry(tx, newAuditEntry("update_expense", id, before, expense)); err != nil {
+		return Expense{}, err
 	}
-	if rowsAffected == 0 {
-		return fmt.Errorf("expense with ID %s not found", id)
+	if err := tx.Commit(); err != nil {
+		return Expense{}, err
 	}
-	return nil
+	return expense, nil
 }
 
 func (s *databaseStore) RemoveExpense(id string) error {
-	query := `DELETE FROM expenses WHERE id = $1`
-	result, err := s.db.Exec(query, id)
+	tx, err := s.db.Begin()
 	if err != nil {
-		return fmt.Errorf("failed to delete expense: %v", err)
+		return fmt.Errorf("failed to begin transaction: %v", err)
 	}
-	rowsAffected, err := result.RowsAffected()
+	defer tx.Rollback()
+	query := `DELETE FROM expenses WHERE id = $1 RETURNING id, recurring_id, name, category, amount, currency, date, tags, splits`
+	removed, err := scanExpense(tx.QueryRow(query, id))
 	if err != nil {
-		return fmt.Errorf("failed to get rows affected: %v", err)
+		if err == sql.ErrNoRows {
+			return fmt.Errorf("expense with ID %s %w", id, ErrNotFound)
+		}
+		return fmt.Errorf("failed to delete expense: %v", err)
 	}
-	if rowsAffected == 0 {
-		return fmt.Errorf("expense with ID %s not found", id)
+	if err := insertAuditEntry(tx, newAuditEntry("remove_expense", id, removed, nil)); err != nil {
+		return err
 	}
-	return nil
+	return tx.Commit()
 }
 
 func (s *databaseStore) AddMultipleExpenses(expenses []Expense) error {
 	if len(expenses) == 0 {
 		return nil
 	}
-	// use the same addexpense method
-	for _, exp := range expenses {
-		if err := s.AddExpense(exp); err != nil {
+	if err := s.checkCategories(expenses...); err != nil {
+		return err
+	}
+	tx, err := s.db.Begin()
+	if err != nil {
+		return fmt.Errorf("failed to begin transaction: %v", err)
+	}
+	defer tx.Rollback()
+	added := make([]Expense, len(expenses))
+	for i, exp := range expenses {
+		if err := s.insertExpense(tx, &exp); err != nil {
 			return err
 		}
+		added[i] = exp
 	}
-	return nil
+	if err := insertAuditEntry(tx, newAuditEntry("add_expenses", "", nil, added)); err != nil {
+		return err
+	}
+	return tx.Commit()
 }
 
 func (s *databaseStore) RemoveMultipleExpenses(ids []string) error {
 	if len(ids) == 0 {
 		return nil
 	}
-	query := `DELETE FROM expenses WHERE id = ANY($1)`
-	_, err := s.db.Exec(query, pq.Array(ids))
+	tx, err := s.db.Begin()
+	if err != nil {
+		return fmt.Errorf("failed to begin transaction: %v", err)
+	}
+	defer tx.Rollback()
+	query := `DELETE FROM expenses WHERE id = ANY($1) RETURNING id, recurring_id, name, category, amount, currency, date, tags, splits`
+	rows, err := tx.Query(query, pq.Array(ids))
 	if err != nil {
 		return fmt.Errorf("failed to delete multiple expenses: %v", err)
 	}
-	return nil
+	var removed []Expense
+	for rows.Next() {
+		expense, err := scanExpense(rows)
+		if err != nil {
+			rows.Close()
+			return fmt.Errorf("failed to scan deleted expense: %v", err)
+		}
+		removed = append(removed, expense)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return fmt.Errorf("failed to delete multiple expenses: %v", err)
+	}
+	if len(removed) == 0 {
+		return nil
+	}
+	if err := insertAuditEntry(tx, newAuditEntry("remove_expenses", "", removed, nil)); err != nil {
+		return err
+	}
+	return tx.Commit()
 }
 
 func scanRecurringExpense(scanner interface{ Scan(...any) error }) (RecurringExpense, error) {
 	var re RecurringExpense
 	var tagsStr sql.NullString
-	err := scanner.Scan(&re.ID, &re.Name, &re.Amount, &re.Currency, &re.Category, &re.StartDate, &re.Interval, &re.Occurrences, &tagsStr)
+	err := scanner.Scan(&re.ID, &re.Name, &re.Amount, &re.Currency, &re.Category, &re.StartDate, &re.Interval, &re.Occurrences, &tagsStr, &re.SkipWeekends, &re.SkipHolidays)
 	if err != nil {
 		return RecurringExpense{}, err
 	}
@@ -360,7 +1075,7 @@ func scanRecurringExpense(scanner interface{ Scan(...any) error }) (RecurringExp
 }
 
 func (s *databaseStore) GetRecurringExpenses() ([]RecurringExpense, error) {
-	query := `SELECT id, name, amount, currency, category, start_date, interval, occurrences, tags FROM recurring_expenses`
+	query := `SELECT id, name, amount, currency, category, start_date, interval, occurrences, tags, skip_weekends, skip_holidays FROM recurring_expenses`
 	rows, err := s.db.Query(query)
 	if err != nil {
 		return nil, fmt.Errorf("failed to query recurring expenses: %v", err)
@@ -378,11 +1093,11 @@ func (s *databaseStore) GetRecurringExpenses() ([]RecurringExpense, error) {
 }
 
 func (s *databaseStore) GetRecurringExpense(id string) (RecurringExpense, error) {
-	query := `SELECT id, name, amount, category, start_date, interval, occurrences, tags FROM recurring_expenses WHERE id = $1`
+	query := `SELECT id, name, amount, currency, category, start_date, interval, occurrences, tags, skip_weekends, skip_holidays FROM recurring_expenses WHERE id = $1`
 	re, err := scanRecurringExpense(s.db.QueryRow(query, id))
 	if err != nil {
 		if err == sql.ErrNoRows {
-			return RecurringExpense{}, fmt.Errorf("recurring expense with ID %s not found", id)
+			return RecurringExpense{}, fmt.Errorf("recurring expense with ID %s %w", id, ErrNotFound)
 		}
 		return RecurringExpense{}, fmt.Errorf("failed to get recurring expense: %v", err)
 	}
@@ -390,6 +1105,13 @@ func (s *databaseStore) GetRecurringExpense(id string) (RecurringExpense, error)
 }
 
 func (s *databaseStore) AddRecurringExpense(recurringExpense RecurringExpense) error {
+	if err := s.checkCategories(Expense{Category: recurringExpense.Category}); err != nil {
+		return err
+	}
+	holidays, err := s.holidays()
+	if err != nil {
+		return err
+	}
 	tx, err := s.db.Begin()
 	if err != nil {
 		return fmt.Errorf("failed to begin transaction: %v", err)
@@ -399,96 +1121,114 @@ func (s *databaseStore) AddRecurringExpense(recurringExpense RecurringExpense) e
 	if recurringExpense.ID == "" {
 		recurringExpense.ID = uuid.New().String()
 	}
-	if recurringExpense.Currency == "" {
-		recurringExpense.Currency = s.defaults["currency"]
-	}
+	recurringExpense.Currency = resolveCurrency(recurringExpense.Currency, s.configuredCurrency())
 	tagsJSON, _ := json.Marshal(recurringExpense.Tags)
 	ruleQuery := `
-		INSERT INTO recurring_expenses (id, name, amount, currency, category, start_date, interval, occurrences, tags)
-		VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9)
+		INSERT INTO recurring_expenses (id, name, amount, currency, category, start_date, interval, occurrences, tags, skip_weekends, skip_holidays)
+		VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11)
 	`
-	_, err = tx.Exec(ruleQuery, recurringExpense.ID, recurringExpense.Name, recurringExpense.Amount, recurringExpense.Currency, recurringExpense.Category, recurringExpense.StartDate, recurringExpense.Interval, recurringExpense.Occurrences, string(tagsJSON))
+	_, err = tx.Exec(ruleQuery, recurringExpense.ID, recurringExpense.Name, recurringExpense.Amount, recurringExpense.Currency, recurringExpense.Category, recurringExpense.StartDate, recurringExpense.Interval, recurringExpense.Occurrences, string(tagsJSON), recurringExpense.SkipWeekends, recurringExpense.SkipHolidays)
 	if err != nil {
 		return fmt.Errorf("failed to insert recurring expense rule: %v", err)
 	}
 
-	expensesToAdd := generateExpensesFromRecurring(recurringExpense, false)
-	if len(expensesToAdd) > 0 {
-		stmt, err := tx.Prepare(pq.CopyIn("expenses", "id", "recurring_id", "name", "category", "amount", "currency", "date", "tags"))
-		if err != nil {
-			return fmt.Errorf("failed to prepare copy in: %v", err)
-		}
-		defer stmt.Close()
-		for _, exp := range expensesToAdd {
-			expTagsJSON, _ := json.Marshal(exp.Tags)
-			_, err = stmt.Exec(exp.ID, exp.RecurringID, exp.Name, exp.Category, exp.Amount, exp.Currency, exp.Date, string(expTagsJSON))
-			if err != nil {
-				return fmt.Errorf("failed to execute copy in: %v", err)
-			}
-		}
-		if _, err = stmt.Exec(); err != nil {
-			return fmt.Errorf("failed to finalize copy in: %v", err)
-		}
+	expensesToAdd := generateExpensesFromRecurring(recurringExpense, time.Time{}, holidays)
+	if err := copyInExpenses(tx, expensesToAdd); err != nil {
+		return err
 	}
-	return tx.Commit()
+	if err := insertAuditEntry(tx, newAuditEntry("add_recurring_expense", recurringExpense.ID, nil, recurringExpense)); err != nil {
+		return err
+	}
+	return s.commitConfig(tx)
 }
 
 func (s *databaseStore) UpdateRecurringExpense(id string, recurringExpense RecurringExpense, updateAll bool) error {
+	if err := s.checkCategories(Expense{Category: recurringExpense.Category}); err != nil {
+		return err
+	}
+	holidays, err := s.holidays()
+	if err != nil {
+		return err
+	}
 	tx, err := s.db.Begin()
 	if err != nil {
 		return fmt.Errorf("failed to begin transaction: %v", err)
 	}
 	defer tx.Rollback()
 	recurringExpense.ID = id // Ensure ID is preserved
-	if recurringExpense.Currency == "" {
-		recurringExpense.Currency = s.defaults["currency"]
+	selectQuery := `SELECT id, name, amount, currency, category, start_date, interval, occurrences, tags, skip_weekends, skip_holidays FROM recurring_expenses WHERE id = $1 FOR UPDATE`
+	before, err := scanRecurringExpense(tx.QueryRow(selectQuery, id))
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return fmt.Errorf("recurring expense with ID %s %w", id, ErrNotFound)
+		}
+		return fmt.Errorf("failed to get recurring expense: %v", err)
 	}
+	// keep the currency the rule was created with rather than the current default
+	recurringExpense.Currency = resolveCurrency(recurringExpense.Currency, resolveCurrency(before.Currency, s.configuredCurrency()))
 	tagsJSON, _ := json.Marshal(recurringExpense.Tags)
 	ruleQuery := `
 		UPDATE recurring_expenses
-		SET name = $1, amount = $2, category = $3, start_date = $4, interval = $5, occurrences = $6, tags = $7, currency = $8
-		WHERE id = $9
+		SET name = $1, amount = $2, category = $3, start_date = $4, interval = $5, occurrences = $6, tags = $7, currency = $8, skip_weekends = $9, skip_holidays = $10
+		WHERE id = $11
 	`
-	res, err := tx.Exec(ruleQuery, recurringExpense.Name, recurringExpense.Amount, recurringExpense.Category, recurringExpense.StartDate, recurringExpense.Interval, recurringExpense.Occurrences, string(tagsJSON), recurringExpense.Currency, id)
+	_, err = tx.Exec(ruleQuery, recurringExpense.Name, recurringExpense.Amount, recurringExpense.Category, recurringExpense.StartDate, recurringExpense.Interval, recurringExpense.Occurrences, string(tagsJSON), recurringExpense.Currency, recurringExpense.SkipWeekends, recurringExpense.SkipHolidays, id)
 	if err != nil {
 		return fmt.Errorf("failed to update recurring expense rule: %v", err)
 	}
-	rowsAffected, _ := res.RowsAffected()
-	if rowsAffected == 0 {
-		return fmt.Errorf("recurring expense with ID %s not found to update", id)
-	}
 
-	var deleteQuery string
-	if updateAll {
-		deleteQuery = `DELETE FROM expenses WHERE recurring_id = $1`
-		_, err = tx.Exec(deleteQuery, id)
-	} else {
-		deleteQuery = `DELETE FROM expenses WHERE recurring_id = $1 AND date > $2`
-		_, err = tx.Exec(deleteQuery, id, time.Now())
-	}
+	// instances before the cutoff are kept and those from it onwards are
+	// regenerated, so both steps must share the same cutoff; the zero cutoff
+	// of updateAll deletes every instance
+	cutoff := recurringCutoff(updateAll)
+	_, err = tx.Exec(`DELETE FROM expenses WHERE recurring_id = $1 AND date >= $2`, id, cutoff)
 	if err != nil {
 		return fmt.Errorf("failed to delete old expense instances for update: %v", err)
 	}
 
-	expensesToAdd := generateExpensesFromRecurring(recurringExpense, !updateAll)
-	if len(expensesToAdd) > 0 {
-		stmt, err := tx.Prepare(pq.CopyIn("expenses", "id", "recurring_id", "name", "category", "amount", "currency", "date", "tags"))
-		if err != nil {
-			return fmt.Errorf("failed to prepare copy in for update: %v", err)
-		}
-		defer stmt.Close()
-		for _, exp := range expensesToAdd {
-			expTagsJSON, _ := json.Marshal(exp.Tags)
-			_, err = stmt.Exec(exp.ID, exp.RecurringID, exp.Name, exp.Category, exp.Amount, exp.Currency, exp.Date, string(expTagsJSON))
-			if err != nil {
-				return fmt.Errorf("failed to execute copy in for update: %v", err)
-			}
+	expensesToAdd := generateExpensesFromRecurring(recurringExpense, cutoff, holidays)
+	if err := copyInExpenses(tx, expensesToAdd); err != nil {
+		return err
+	}
+	if err := insertAuditEntry(tx, newAuditEntry("update_recurring_expense", id, before, recurringExpense)); err != nil {
+		return err
+	}
+	return s.commitConfig(tx)
+}
+
+func (s *databaseStore) RegenerateRecurringExpenses() (map[string]int, error) {
+	recurringExpenses, err := s.GetRecurringExpenses()
+	if err != nil {
+		return nil, err
+	}
+	holidays, err := s.holidays()
+	if err != nil {
+		return nil, err
+	}
+	tx, err := s.db.Begin()
+	if err != nil {
+		return nil, fmt.Errorf("failed to begin transaction: %v", err)
+	}
+	defer tx.Rollback()
+	cutoff := recurringCutoff(false)
+	created := make(map[string]int, len(recurringExpenses))
+	for _, re := range recurringExpenses {
+		if _, err := tx.Exec(`DELETE FROM expenses WHERE recurring_id = $1 AND date >= $2`, re.ID, cutoff); err != nil {
+			return nil, fmt.Errorf("failed to delete future instances of recurring expense %s: %v", re.ID, err)
 		}
-		if _, err = stmt.Exec(); err != nil {
-			return fmt.Errorf("failed to finalize copy in for update: %v", err)
+		expensesToAdd := generateExpensesFromRecurring(re, cutoff, holidays)
+		if err := copyInExpenses(tx, expensesToAdd); err != nil {
+			return nil, err
 		}
+		created[re.ID] = len(expensesToAdd)
 	}
-	return tx.Commit()
+	if err := insertAuditEntry(tx, newAuditEntry("regenerate_recurring_expenses", "", nil, created)); err != nil {
+		return nil, err
+	}
+	if err := tx.Commit(); err != nil {
+		return nil, fmt.Errorf("failed to commit transaction: %v", err)
+	}
+	return created, nil
 }
 
 func (s *databaseStore) RemoveRecurringExpense(id string, removeAll bool) error {
@@ -497,53 +1237,124 @@ func (s *databaseStore) RemoveRecurringExpense(id string, removeAll bool) error
 		return fmt.Errorf("failed to begin transaction: %v", err)
 	}
 	defer tx.Rollback()
-	res, err := tx.Exec(`DELETE FROM recurring_expenses WHERE id = $1`, id)
+	ruleQuery := `DELETE FROM recurring_expenses WHERE id = $1 RETURNING id, name, amount, currency, category, start_date, interval, occurrences, tags, skip_weekends, skip_holidays`
+	removed, err := scanRecurringExpense(tx.QueryRow(ruleQuery, id))
 	if err != nil {
+		if err == sql.ErrNoRows {
+			return fmt.Errorf("recurring expense with ID %s %w", id, ErrNotFound)
+		}
 		return fmt.Errorf("failed to delete recurring expense rule: %v", err)
 	}
-	rowsAffected, _ := res.RowsAffected()
-	if rowsAffected == 0 {
-		return fmt.Errorf("recurring expense with ID %s not found", id)
+
+	// same cutoff as UpdateRecurringExpense, zero for removeAll
+	_, err = tx.Exec(`DELETE FROM expenses WHERE recurring_id = $1 AND date >= $2`, id, recurringCutoff(removeAll))
+	if err != nil {
+		return fmt.Errorf("failed to delete expense instances: %v", err)
+	}
+	if err := insertAuditEntry(tx, newAuditEntry("remove_recurring_expense", id, removed, nil)); err != nil {
+		return err
 	}
+	return s.commitConfig(tx)
+}
 
-	var deleteQuery string
-	if removeAll {
-		deleteQuery = `DELETE FROM expenses WHERE recurring_id = $1`
-		_, err = tx.Exec(deleteQuery, id)
-	} else {
-		deleteQuery = `DELETE FROM expenses WHERE recurring_id = $1 AND date > $2`
-		_, err = tx.Exec(deleteQuery, id, time.Now())
+func (s *databaseStore) GetRecurringExpensesDue(asOf time.Time) ([]RecurringExpense, error) {
+	recurringExpenses, err := s.GetRecurringExpenses()
+	if err != nil {
+		return nil, err
 	}
+	holidays, err := s.holidays()
 	if err != nil {
-		return fmt.Errorf("failed to delete expense instances: %v", err)
+		return nil, err
 	}
-	return tx.Commit()
+	query := `
+		SELECT recurring_id, COUNT(*), MAX(date) FROM expenses
+		WHERE recurring_id IS NOT NULL AND recurring_id <> ''
+		GROUP BY recurring_id
+	`
+	rows, err := s.db.Query(query)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query recurring expense instances: %v", err)
+	}
+	defer rows.Close()
+	generated := make(map[string]int)
+	latest := make(map[string]time.Time)
+	for rows.Next() {
+		var id string
+		var count int
+		var maxDate time.Time
+		if err := rows.Scan(&id, &count, &maxDate); err != nil {
+			return nil, fmt.Errorf("failed to scan recurring expense instances: %v", err)
+		}
+		generated[id] = count
+		latest[id] = maxDate
+	}
+	var due []RecurringExpense
+	for _, r := range recurringExpenses {
+		if isRecurringDue(r, generated[r.ID], latest[r.ID], asOf, holidays) {
+			due = append(due, r)
+		}
+	}
+	return due, nil
 }
 
-func generateExpensesFromRecurring(recExp RecurringExpense, fromToday bool) []Expense {
-	var expenses []Expense
-	currentDate := recExp.StartDate
-	today := time.Now()
-	occurrencesToGenerate := recExp.Occurrences
-	if fromToday {
-		for currentDate.Before(today) && (recExp.Occurrences == 0 || occurrencesToGenerate > 0) {
-			switch recExp.Interval {
-			case "daily":
-				currentDate = currentDate.AddDate(0, 0, 1)
-			case "weekly":
-				currentDate = currentDate.AddDate(0, 0, 7)
-			case "monthly":
-				currentDate = currentDate.AddDate(0, 1, 0)
-			case "yearly":
-				currentDate = currentDate.AddDate(1, 0, 0)
-			default:
-				return expenses // Stop if interval is invalid
-			}
-			if recExp.Occurrences > 0 {
-				occurrencesToGenerate--
-			}
+// Audit Log
+
+func (s *databaseStore) GetAuditLog(limit, offset int) ([]AuditEntry, error) {
+	query := `
+		SELECT id, created_at, operation, entity_id, diff FROM audit_log
+		ORDER BY seq DESC
+		LIMIT $1 OFFSET $2
+	`
+	rows, err := s.db.Query(query, limit, offset)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query audit log: %v", err)
+	}
+	defer rows.Close()
+	return scanAuditEntries(rows)
+}
+
+func (s *databaseStore) GetAuditLogSince(afterID string, limit int) ([]AuditEntry, error) {
+	// a zero seq starts from the beginning when afterID is empty or has been removed
+	var after int64
+	if afterID != "" {
+		err := s.db.QueryRow(`SELECT seq FROM audit_log WHERE id = $1`, afterID).Scan(&after)
+		if err != nil && err != sql.ErrNoRows {
+			return nil, fmt.Errorf("failed to find audit entry: %v", err)
+		}
+	}
+	query := `
+		SELECT id, created_at, operation, entity_id, diff FROM audit_log
+		WHERE seq > $1
+		ORDER BY seq
+		LIMIT $2
+	`
+	rows, err := s.db.Query(query, after, limit)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query audit log: %v", err)
+	}
+	defer rows.Close()
+	return scanAuditEntries(rows)
+}
+
+func scanAuditEntries(rows *sql.Rows) ([]AuditEntry, error) {
+	entries := []AuditEntry{}
+	for rows.Next() {
+		var entry AuditEntry
+		var diff string
+		if err := rows.Scan(&entry.ID, &entry.Timestamp, &entry.Operation, &entry.EntityID, &diff); err != nil {
+			return nil, fmt.Errorf("failed to scan audit entry: %v", err)
 		}
+		entry.Diff = json.RawMessage(diff)
+		entries = append(entries, entry)
 	}
+	return entries, rows.Err()
+}
+
+// generates the rule's instances dated on or after `from`; a zero `from`
+// generates all of them, a `from` before the start date changes nothing
+func generateExpensesFromRecurring(recExp RecurringExpense, from time.Time, holidays []string) []Expense {
+	var expenses []Expense
+	currentDate, occurrencesToGenerate := NextOccurrence(recExp, from, holidays)
 	limit := occurrencesToGenerate
 	// if recExp.Occurrences == 0 {
 	// 	limit = 2000 // Heuristic for "indefinite"
@@ -561,18 +1372,119 @@ func generateExpensesFromRecurring(recExp RecurringExpense, fromToday bool) []Ex
 			Tags:        recExp.Tags,
 		}
 		expenses = append(expenses, expense)
-		switch recExp.Interval {
-		case "daily":
-			currentDate = currentDate.AddDate(0, 0, 1)
-		case "weekly":
-			currentDate = currentDate.AddDate(0, 0, 7)
-		case "monthly":
-			currentDate = currentDate.AddDate(0, 1, 0)
-		case "yearly":
-			currentDate = currentDate.AddDate(1, 0, 0)
-		default:
+		nextDate, ok := recExp.nextDate(currentDate, holidays)
+		if !ok {
 			return expenses
 		}
+		currentDate = nextDate
 	}
 	return expenses
 }
+
+// bulk inserts generated recurring instances within the transaction
+func copyInExpenses(tx *sql.Tx, expenses []Expense) error {
+	if len(expenses) == 0 {
+		return nil
+	}
+	stmt, err := tx.Prepare(pq.CopyIn("expenses", "id", "recurring_id", "name", "category", "amount", "currency", "date", "tags"))
+	if err != nil {
+		return fmt.Errorf("failed to prepare copy in: %v", err)
+	}
+	defer stmt.Close()
+	for _, exp := range expenses {
+		expTagsJSON, _ := json.Marshal(exp.Tags)
+		_, err = stmt.Exec(exp.ID, exp.RecurringID, exp.Name, exp.Category, exp.Amount, exp.Currency, exp.Date, string(expTagsJSON))
+		if err != nil {
+			return fmt.Errorf("failed to execute copy in: %v", err)
+		}
+	}
+	if _, err = stmt.Exec(); err != nil {
+		return fmt.Errorf("failed to finalize copy in: %v", err)
+	}
+	return nil
+}
+
+// advances date by one step of the interval, false if the interval is invalid
+func nextRecurringDate(date time.Time, interval string) (time.Time, bool) {
+	switch interval {
+	case "daily":
+		return date.AddDate(0, 0, 1), true
+	case "weekly":
+		return date.AddDate(0, 0, 7), true
+	case "monthly":
+		return date.AddDate(0, 1, 0), true
+	case "yearly":
+		return date.AddDate(1, 0, 0), true
+	}
+	return date, false
+}
+
+// reports whether the rule leaves out the given date; holidays are sorted
+// YYYY-MM-DD dates, compared against the date's own calendar day
+func (recExp RecurringExpense) skips(date time.Time, holidays []string) bool {
+	if recExp.SkipHolidays {
+		if _, found := slices.BinarySearch(holidays, date.Format(time.DateOnly)); found {
+			return true
+		}
+	}
+	if !recExp.SkipWeekends || recExp.Interval != "daily" {
+		return false
+	}
+	weekday := date.Weekday()
+	return weekday == time.Saturday || weekday == time.Sunday
+}
+
+// returns the date of the rule's first occurrence, which is the start date
+// unless the rule skips it
+func (recExp RecurringExpense) firstDate(holidays []string) time.Time {
+	if recExp.skips(recExp.StartDate, holidays) {
+		if next, ok := recExp.nextDate(recExp.StartDate, holidays); ok {
+			return next
+		}
+	}
+	return recExp.StartDate
+}
+
+// advances date to the rule's next occurrence, stepping over skipped dates so
+// they don't count towards the occurrences; false if the interval is invalid
+func (recExp RecurringExpense) nextDate(date time.Time, holidays []string) (time.Time, bool) {
+	next, ok := nextRecurringDate(date, recExp.Interval)
+	for ok && recExp.skips(next, holidays) {
+		next, ok = nextRecurringDate(next, recExp.Interval)
+	}
+	return next, ok
+}
+
+// steps through the occurrences of a rule until the first one not before asOf,
+// returning its date and the number of occurrences left from it onwards
+func NextOccurrence(recExp RecurringExpense, asOf time.Time, holidays []string) (time.Time, int) {
+	currentDate := recExp.firstDate(holidays)
+	remaining := recExp.Occurrences
+	for currentDate.Before(asOf) && (recExp.Occurrences == 0 || remaining > 0) {
+		nextDate, ok := recExp.nextDate(currentDate, holidays)
+		if !ok {
+			return currentDate, 0 // Stop if interval is invalid
+		}
+		currentDate = nextDate
+		if recExp.Occurrences > 0 {
+			remaining--
+		}
+	}
+	return currentDate, remaining
+}
+
+// checks if a rule with `generated` instances (the latest on `latest`) still
+// has occurrences left and its next expected instance falls on or before asOf
+func isRecurringDue(recExp RecurringExpense, generated int, latest time.Time, asOf time.Time, holidays []string) bool {
+	if generated >= recExp.Occurrences {
+		return false
+	}
+	next := recExp.firstDate(holidays)
+	if generated > 0 {
+		var ok bool
+		if next, ok = recExp.nextDate(latest, holidays); !ok {
+			return false
+		}
+	}
+	return !next.After(asOf)
+}
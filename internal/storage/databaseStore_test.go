@@ -0,0 +1,120 @@
+package storage
+
+import (
+	"testing"
+	"time"
+)
+
+// january 2026, where the 2nd is a Friday and the 3rd a Saturday
+func jan(day int) time.Time {
+	return time.Date(2026, time.January, day, 0, 0, 0, 0, time.UTC)
+}
+
+func TestGenerateExpensesFromRecurring(t *testing.T) {
+	tests := []struct {
+		name     string
+		rule     RecurringExpense
+		holidays []string
+		want     []time.Time
+	}{
+		{
+			name: "saturday start skipping weekends",
+			rule: RecurringExpense{StartDate: jan(3), Interval: "daily", Occurrences: 3, SkipWeekends: true},
+			want: []time.Time{jan(5), jan(6), jan(7)},
+		},
+		{
+			name: "friday start crossing a weekend",
+			rule: RecurringExpense{StartDate: jan(2), Interval: "daily", Occurrences: 3, SkipWeekends: true},
+			want: []time.Time{jan(2), jan(5), jan(6)},
+		},
+		{
+			name: "friday start keeping weekends",
+			rule: RecurringExpense{StartDate: jan(2), Interval: "daily", Occurrences: 3},
+			want: []time.Time{jan(2), jan(3), jan(4)},
+		},
+		{
+			name: "weekly rules ignore skipping weekends",
+			rule: RecurringExpense{StartDate: jan(3), Interval: "weekly", Occurrences: 2, SkipWeekends: true},
+			want: []time.Time{jan(3), jan(10)},
+		},
+		{
+			name:     "holiday after a weekend",
+			rule:     RecurringExpense{StartDate: jan(2), Interval: "daily", Occurrences: 3, SkipWeekends: true, SkipHolidays: true},
+			holidays: []string{"2026-01-05"},
+			want:     []time.Time{jan(2), jan(6), jan(7)},
+		},
+		{
+			name:     "holidays ignored unless opted in",
+			rule:     RecurringExpense{StartDate: jan(2), Interval: "daily", Occurrences: 2},
+			holidays: []string{"2026-01-02"},
+			want:     []time.Time{jan(2), jan(3)},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			expenses := generateExpensesFromRecurring(tt.rule, time.Time{}, tt.holidays)
+			if len(expenses) != tt.rule.Occurrences {
+				t.Fatalf("generated %d instances, want %d", len(expenses), tt.rule.Occurrences)
+			}
+			for i, expense := range expenses {
+				if !expense.Date.Equal(tt.want[i]) {
+					t.Errorf("instance %d dated %s, want %s", i, expense.Date.Format(time.DateOnly), tt.want[i].Format(time.DateOnly))
+				}
+			}
+		})
+	}
+}
+
+func TestNextOccurrence(t *testing.T) {
+	friday := RecurringExpense{StartDate: jan(2), Interval: "daily", Occurrences: 5, SkipWeekends: true}
+	saturday := RecurringExpense{StartDate: jan(3), Interval: "daily", Occurrences: 5, SkipWeekends: true}
+	tests := []struct {
+		name          string
+		rule          RecurringExpense
+		asOf          time.Time
+		wantDate      time.Time
+		wantRemaining int
+	}{
+		{name: "before the start", rule: friday, asOf: time.Time{}, wantDate: jan(2), wantRemaining: 5},
+		{name: "on the start", rule: friday, asOf: jan(2), wantDate: jan(2), wantRemaining: 5},
+		{name: "during the weekend", rule: friday, asOf: jan(3), wantDate: jan(5), wantRemaining: 4},
+		{name: "saturday start", rule: saturday, asOf: time.Time{}, wantDate: jan(5), wantRemaining: 5},
+		{name: "after the last occurrence", rule: friday, asOf: jan(20), wantDate: jan(9), wantRemaining: 0},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			date, remaining := NextOccurrence(tt.rule, tt.asOf, nil)
+			if !date.Equal(tt.wantDate) || remaining != tt.wantRemaining {
+				t.Errorf("got %s with %d left, want %s with %d left", date.Format(time.DateOnly), remaining, tt.wantDate.Format(time.DateOnly), tt.wantRemaining)
+			}
+		})
+	}
+}
+
+func TestIsRecurringDue(t *testing.T) {
+	friday := RecurringExpense{StartDate: jan(2), Interval: "daily", Occurrences: 3, SkipWeekends: true}
+	saturday := RecurringExpense{StartDate: jan(3), Interval: "daily", Occurrences: 3, SkipWeekends: true}
+	tests := []struct {
+		name      string
+		rule      RecurringExpense
+		generated int
+		latest    time.Time
+		asOf      time.Time
+		want      bool
+	}{
+		{name: "first instance due", rule: friday, asOf: jan(2), want: true},
+		{name: "first instance not yet due", rule: friday, asOf: jan(1), want: false},
+		{name: "next instance after the weekend", rule: friday, generated: 1, latest: jan(2), asOf: jan(4), want: false},
+		{name: "next instance on monday", rule: friday, generated: 1, latest: jan(2), asOf: jan(5), want: true},
+		{name: "all occurrences generated", rule: friday, generated: 3, latest: jan(6), asOf: jan(20), want: false},
+		{name: "saturday start waits for monday", rule: saturday, asOf: jan(4), want: false},
+		{name: "saturday start due on monday", rule: saturday, asOf: jan(5), want: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := isRecurringDue(tt.rule, tt.generated, tt.latest, tt.asOf, nil); got != tt.want {
+				t.Errorf("isRecurringDue() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
@@ -1,11 +1,13 @@
 package storage
 
 import (
+	"bytes"
 	"encoding/json"
 	"fmt"
 	"log"
 	"os"
 	"path/filepath"
+	"runtime"
 	"slices"
 	"sync"
 	"time"
@@ -15,22 +17,43 @@ import (
 
 // JSONStore implementats Storage interface - for JSON file storage
 type jsonStore struct {
+	dataDir    string
 	configPath string
 	filePath   string
+	auditPath  string
 	mu         sync.RWMutex
 	defaults   map[string]string // allows reusing defaults without querying for config
+	cache      expensesCache
 }
 
 type expensesFileData struct {
 	Expenses []Expense `json:"expenses"`
 }
 
+// parsed expenses file, reused until the file's mtime or size changes
+type expensesCache struct {
+	mu      sync.Mutex // readers share s.mu, so the cache needs its own lock
+	data    *expensesFileData
+	modTime time.Time
+	size    int64
+}
+
 func InitializeJsonStore(baseConfig SystemConfig) (*jsonStore, error) {
-	configPath := filepath.Join(baseConfig.StorageURL, "config.json")
-	filePath := filepath.Join(baseConfig.StorageURL, "expenses.json")
-	if err := os.MkdirAll(filepath.Dir(filePath), 0755); err != nil {
-		return nil, fmt.Errorf("failed to create storage directory: %v", err)
+	// resolved once so the store doesn't depend on the working directory later
+	dataDir, err := filepath.Abs(baseConfig.StorageURL)
+	if err != nil {
+		return nil, fmt.Errorf("failed to resolve data directory %s: %v", baseConfig.StorageURL, err)
+	}
+	if err := os.MkdirAll(dataDir, 0755); err != nil {
+		return nil, fmt.Errorf("failed to create data directory %s: %v", dataDir, err)
 	}
+	if err := checkDirWritable(dataDir); err != nil {
+		return nil, err
+	}
+	log.Printf("Using data directory %s\n", dataDir)
+	configPath := filepath.Join(dataDir, "config.json")
+	filePath := filepath.Join(dataDir, "expenses.json")
+	auditPath := filepath.Join(dataDir, "audit.jsonl")
 
 	// create expenses file if it doesn't exist
 	if _, err := os.Stat(filePath); os.IsNotExist(err) {
@@ -39,7 +62,7 @@ func InitializeJsonStore(baseConfig SystemConfig) (*jsonStore, error) {
 		if err != nil {
 			return nil, fmt.Errorf("failed to marshal initial data: %v", err)
 		}
-		if err := os.WriteFile(filePath, data, 0644); err != nil {
+		if err := writeFileAtomic(filePath, data); err != nil {
 			return nil, fmt.Errorf("failed to create storage file: %v", err)
 		}
 		log.Println("Created expense storage file")
@@ -55,7 +78,7 @@ func InitializeJsonStore(baseConfig SystemConfig) (*jsonStore, error) {
 		if err != nil {
 			return nil, fmt.Errorf("failed to marshal initial config: %v", err)
 		}
-		if err := os.WriteFile(configPath, data, 0644); err != nil {
+		if err := writeFileAtomic(configPath, data); err != nil {
 			return nil, fmt.Errorf("failed to create config file: %v", err)
 		}
 		log.Println("Created expense storage config")
@@ -64,34 +87,71 @@ func InitializeJsonStore(baseConfig SystemConfig) (*jsonStore, error) {
 	}
 
 	return &jsonStore{
+		dataDir:    dataDir,
 		configPath: configPath,
 		filePath:   filePath,
+		auditPath:  auditPath,
 		defaults:   map[string]string{},
 	}, nil
 }
 
+// creates and removes a temp file to surface permission problems at startup
+// rather than on the first write
+func checkDirWritable(dir string) error {
+	f, err := os.CreateTemp(dir, ".write-check-*")
+	if err != nil {
+		return fmt.Errorf("data directory %s is not writable: %v", dir, err)
+	}
+	f.Close()
+	return os.Remove(f.Name())
+}
+
 // primitive methods
 
+// copies the expenses so callers can modify them without touching the cache
+func (d *expensesFileData) clone() *expensesFileData {
+	expenses := make([]Expense, len(d.Expenses))
+	for i, exp := range d.Expenses {
+		exp.Tags = slices.Clone(exp.Tags)
+		exp.Splits = slices.Clone(exp.Splits)
+		expenses[i] = exp
+	}
+	return &expensesFileData{Expenses: expenses}
+}
+
+// returns a copy of the expenses, re-parsing the file only when it changed on disk
 func (s *jsonStore) readExpensesFile(path string) (*expensesFileData, error) {
-	content, err := os.ReadFile(path)
+	info, err := os.Stat(path)
 	if err != nil {
 		return nil, err
 	}
-	var data expensesFileData
-	if err := json.Unmarshal(content, &data); err != nil {
-		return nil, err
+	s.cache.mu.Lock()
+	defer s.cache.mu.Unlock()
+	if s.cache.data == nil || !info.ModTime().Equal(s.cache.modTime) || info.Size() != s.cache.size {
+		content, err := os.ReadFile(path)
+		if err != nil {
+			return nil, err
+		}
+		var data expensesFileData
+		if err := json.Unmarshal(content, &data); err != nil {
+			return nil, err
+		}
+		s.cache.data, s.cache.modTime, s.cache.size = &data, info.ModTime(), info.Size()
+		log.Println("Read expenses file")
 	}
-	log.Println("Read expenses file")
-	return &data, nil
+	return s.cache.data.clone(), nil
 }
 
 func (s *jsonStore) writeExpensesFile(path string, data *expensesFileData) error {
+	s.cache.mu.Lock()
+	s.cache.data = nil // the mtime alone may not change on coarse-grained filesystems
+	s.cache.mu.Unlock()
 	content, err := json.MarshalIndent(data, "", "    ")
 	if err != nil {
 		return err
 	}
 	log.Println("Wrote expenses file")
-	return os.WriteFile(path, content, 0644)
+	return writeFileAtomic(path, content)
 }
 
 func (s *jsonStore) readConfigFile(path string) (*Config, error) {
@@ -113,7 +173,85 @@ func (s *jsonStore) writeConfigFile(path string, data *Config) error {
 		return err
 	}
 	log.Println("Wrote config file")
-	return os.WriteFile(path, content, 0644)
+	return writeFileAtomic(path, content)
+}
+
+// appends an entry to the audit log; callers must hold s.mu. The change it
+// records is already on disk, so failures are logged rather than returned
+func (s *jsonStore) recordAudit(entry AuditEntry) {
+	line, err := json.Marshal(entry)
+	if err != nil {
+		log.Printf("Failed to marshal audit entry: %v\n", err)
+		return
+	}
+	f, err := os.OpenFile(s.auditPath, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0644)
+	if err != nil {
+		log.Printf("Failed to open audit log: %v\n", err)
+		return
+	}
+	defer f.Close()
+	if _, err := f.Write(append(line, '\n')); err != nil {
+		log.Printf("Failed to write audit log: %v\n", err)
+	}
+}
+
+// replaced in tests to make the final step of writeFileAtomic fail
+var renameFile = os.Rename
+
+// writes to a temp file in the same directory and renames it over path, so a
+// crash mid-write leaves either the old or the new content, never a partial file
+func writeFileAtomic(path string, content []byte) error {
+	tmp, err := os.CreateTemp(filepath.Dir(path), "."+filepath.Base(path)+".tmp-*")
+	if err != nil {
+		return fmt.Errorf("failed to create temp file: %v", err)
+	}
+	defer os.Remove(tmp.Name()) // no-op once renamed
+	if _, err := tmp.Write(content); err != nil {
+		tmp.Close()
+		return fmt.Errorf("failed to write temp file: %v", err)
+	}
+	if err := tmp.Sync(); err != nil {
+		tmp.Close()
+		return fmt.Errorf("failed to sync temp file: %v", err)
+	}
+	if err := tmp.Close(); err != nil {
+		return fmt.Errorf("failed to close temp file: %v", err)
+	}
+	if err := os.Chmod(tmp.Name(), 0644); err != nil {
+		return fmt.Errorf("failed to set temp file permissions: %v", err)
+	}
+	if err := renameFile(tmp.Name(), path); err != nil {
+		return fmt.Errorf("failed to replace %s: %v", filepath.Base(path), err)
+	}
+	// the rename only survives a crash once the directory entry is on disk too
+	return syncDir(filepath.Dir(path))
+}
+
+// flushes a directory's entries to disk; skipped on Windows, which can't open
+// directories for syncing
+func syncDir(dir string) error {
+	if runtime.GOOS == "windows" {
+		return nil
+	}
+	d, err := os.Open(dir)
+	if err != nil {
+		return fmt.Errorf("failed to open %s for syncing: %v", dir, err)
+	}
+	defer d.Close()
+	if err := d.Sync(); err != nil {
+		return fmt.Errorf("failed to sync %s: %v", dir, err)
+	}
+	return nil
+}
+
+// returns the configured currency, loading it on first use; callers must hold s.mu
+func (s *jsonStore) configuredCurrency() string {
+	if s.defaults["currency"] == "" {
+		if config, err := s.readConfigFile(s.configPath); err == nil {
+			s.defaults["currency"] = config.Currency
+		}
+	}
+	return s.defaults["currency"]
 }
 
 // ------------------------------------------------------------
@@ -124,6 +262,32 @@ func (s *jsonStore) Close() error {
 	return nil
 }
 
+func (s *jsonStore) Status() (StorageStatus, error) {
+	status := StorageStatus{Backend: BackendTypeJSON, DataPath: s.dataDir}
+	info, err := os.Stat(s.dataDir)
+	if err != nil {
+		return status, fmt.Errorf("data directory unavailable: %v", err)
+	}
+	if !info.IsDir() {
+		return status, fmt.Errorf("data path %s is not a directory", s.dataDir)
+	}
+	return status, nil
+}
+
+func (s *jsonStore) Counts() (StorageCounts, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	data, err := s.readExpensesFile(s.filePath)
+	if err != nil {
+		return StorageCounts{}, fmt.Errorf("failed to read storage file: %v", err)
+	}
+	config, err := s.readConfigFile(s.configPath)
+	if err != nil {
+		return StorageCounts{}, fmt.Errorf("failed to read config file: %v", err)
+	}
+	return StorageCounts{Expenses: len(data.Expenses), RecurringExpenses: len(config.RecurringExpenses)}, nil
+}
+
 func (s *jsonStore) GetConfig() (*Config, error) {
 	s.mu.RLock()
 	defer s.mu.RUnlock()
@@ -140,6 +304,21 @@ func (s *jsonStore) GetCategories() ([]string, error) {
 	return config.Categories, nil
 }
 
+func (s *jsonStore) GetUsedCategories() ([]string, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	data, err := s.readExpensesFile(s.filePath)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read storage file: %v", err)
+	}
+	used := []string{}
+	for _, exp := range data.Expenses {
+		used = append(used, exp.Category)
+	}
+	slices.Sort(used)
+	return slices.Compact(used), nil
+}
+
 func (s *jsonStore) UpdateCategories(categories []string) error {
 	s.mu.Lock()
 	defer s.mu.Unlock()
@@ -147,8 +326,161 @@ func (s *jsonStore) UpdateCategories(categories []string) error {
 	if err != nil {
 		return fmt.Errorf("failed to read config file: %v", err)
 	}
+	before := data.settings()
 	data.Categories = categories
-	return s.writeConfigFile(s.configPath, data)
+	if err := s.writeConfigFile(s.configPath, data); err != nil {
+		return err
+	}
+	s.recordAudit(newAuditEntry("update_categories", configEntityID, before, data.settings()))
+	return nil
+}
+
+func (s *jsonStore) RenameCategory(oldName, newName string) error {
+	newName, err := ValidateCategory(newName)
+	if err != nil {
+		return err
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	config, err := s.readConfigFile(s.configPath)
+	if err != nil {
+		return fmt.Errorf("failed to read config file: %v", err)
+	}
+	index := slices.Index(config.Categories, oldName)
+	if index == -1 {
+		return fmt.Errorf("category %s %w", oldName, ErrNotFound)
+	}
+	if slices.Contains(config.Categories, newName) {
+		return invalidf("category %s already exists", newName)
+	}
+	before := config.settings()
+	config.Categories[index] = newName
+	config.reassignCategoryColors([]string{oldName}, newName)
+	if err := s.reassignCategories([]string{oldName}, newName, config); err != nil {
+		return err
+	}
+	s.recordAudit(newAuditEntry("rename_category", configEntityID, before, config.settings()))
+	return nil
+}
+
+func (s *jsonStore) MergeCategories(sources []string, target string) error {
+	target, err := ValidateCategory(target)
+	if err != nil {
+		return err
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	config, err := s.readConfigFile(s.configPath)
+	if err != nil {
+		return fmt.Errorf("failed to read config file: %v", err)
+	}
+	before := config.settings()
+	if config.Categories, err = mergeCategoryList(config.Categories, sources, target); err != nil {
+		return err
+	}
+	config.reassignCategoryColors(sources, target)
+	if err := s.reassignCategories(sources, target, config); err != nil {
+		return err
+	}
+	s.recordAudit(newAuditEntry("merge_categories", configEntityID, before, config.settings()))
+	return nil
+}
+
+// moves expenses and recurring expenses from the source categories to target
+// and persists them along with the (already updated) config
+func (s *jsonStore) reassignCategories(sources []string, target string, config *Config) error {
+	for i := range config.RecurringExpenses {
+		if slices.Contains(sources, config.RecurringExpenses[i].Category) {
+			config.RecurringExpenses[i].Category = target
+		}
+	}
+	expensesData, err := s.readExpensesFile(s.filePath)
+	if err != nil {
+		return fmt.Errorf("failed to read storage file: %v", err)
+	}
+	var updated int
+	for i := range expensesData.Expenses {
+		if expensesData.Expenses[i].reassignCategory(sources, target) {
+			updated++
+		}
+	}
+	if updated > 0 {
+		if err := s.writeExpensesFile(s.filePath, expensesData); err != nil {
+			return err
+		}
+	}
+	log.Printf("Moved %d expenses to category %s\n", updated, target)
+	return s.writeConfigFile(s.configPath, config)
+}
+
+func (s *jsonStore) AddCategory(name string) error {
+	name, err := ValidateCategory(name)
+	if err != nil {
+		return err
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	data, err := s.readConfigFile(s.configPath)
+	if err != nil {
+		return fmt.Errorf("failed to read config file: %v", err)
+	}
+	if slices.Contains(data.Categories, name) {
+		return nil
+	}
+	before := data.settings()
+	data.Categories = append(data.Categories, name)
+	if err := s.writeConfigFile(s.configPath, data); err != nil {
+		return err
+	}
+	s.recordAudit(newAuditEntry("add_category", configEntityID, before, data.settings()))
+	return nil
+}
+
+func (s *jsonStore) RemoveCategory(name string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	data, err := s.readConfigFile(s.configPath)
+	if err != nil {
+		return fmt.Errorf("failed to read config file: %v", err)
+	}
+	if !slices.Contains(data.Categories, name) {
+		return nil
+	}
+	before := data.settings()
+	data.Categories = slices.DeleteFunc(data.Categories, func(category string) bool { return category == name })
+	if err := s.writeConfigFile(s.configPath, data); err != nil {
+		return err
+	}
+	s.recordAudit(newAuditEntry("remove_category", configEntityID, before, data.settings()))
+	return nil
+}
+
+func (s *jsonStore) GetCategoryColors() (map[string]string, error) {
+	config, err := s.GetConfig()
+	if err != nil {
+		return nil, err
+	}
+	return config.resolvedCategoryColors(), nil
+}
+
+func (s *jsonStore) UpdateCategoryColors(colors map[string]string) error {
+	colors, err := validateCategoryColors(colors)
+	if err != nil {
+		return err
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	data, err := s.readConfigFile(s.configPath)
+	if err != nil {
+		return fmt.Errorf("failed to read config file: %v", err)
+	}
+	before := data.settings()
+	data.CategoryColors = colors
+	if err := s.writeConfigFile(s.configPath, data); err != nil {
+		return err
+	}
+	s.recordAudit(newAuditEntry("update_category_colors", configEntityID, before, data.settings()))
+	return nil
 }
 
 func (s *jsonStore) GetCurrency() (string, error) {
@@ -169,9 +501,14 @@ func (s *jsonStore) UpdateCurrency(currency string) error {
 	if err != nil {
 		return fmt.Errorf("failed to read config file: %v", err)
 	}
+	before := data.settings()
 	data.Currency = currency
 	s.defaults["currency"] = currency
-	return s.writeConfigFile(s.configPath, data)
+	if err := s.writeConfigFile(s.configPath, data); err != nil {
+		return err
+	}
+	s.recordAudit(newAuditEntry("update_currency", configEntityID, before, data.settings()))
+	return nil
 }
 
 func (s *jsonStore) GetStartDate() (int, error) {
@@ -192,9 +529,129 @@ func (s *jsonStore) UpdateStartDate(startDate int) error {
 	if err != nil {
 		return fmt.Errorf("failed to read config file: %v", err)
 	}
+	before := data.settings()
 	data.StartDate = startDate
 	s.defaults["start_date"] = fmt.Sprintf("%d", startDate)
-	return s.writeConfigFile(s.configPath, data)
+	if err := s.writeConfigFile(s.configPath, data); err != nil {
+		return err
+	}
+	s.recordAudit(newAuditEntry("update_start_date", configEntityID, before, data.settings()))
+	return nil
+}
+
+func (s *jsonStore) UpdateSymbolPosition(position string) error {
+	if !slices.Contains(SymbolPositions, position) {
+		return fmt.Errorf("invalid symbol position: %s", position)
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	data, err := s.readConfigFile(s.configPath)
+	if err != nil {
+		return fmt.Errorf("failed to read config file: %v", err)
+	}
+	before := data.settings()
+	data.SymbolPosition = position
+	if err := s.writeConfigFile(s.configPath, data); err != nil {
+		return err
+	}
+	s.recordAudit(newAuditEntry("update_symbol_position", configEntityID, before, data.settings()))
+	return nil
+}
+
+func (s *jsonStore) UpdateHolidays(holidays []string) error {
+	holidays, err := validateHolidays(holidays)
+	if err != nil {
+		return err
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	data, err := s.readConfigFile(s.configPath)
+	if err != nil {
+		return fmt.Errorf("failed to read config file: %v", err)
+	}
+	before := data.settings()
+	data.Holidays = holidays
+	if err := s.writeConfigFile(s.configPath, data); err != nil {
+		return err
+	}
+	s.recordAudit(newAuditEntry("update_holidays", configEntityID, before, data.settings()))
+	return nil
+}
+
+func (s *jsonStore) UpdateStrictCategories(strict bool) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	data, err := s.readConfigFile(s.configPath)
+	if err != nil {
+		return fmt.Errorf("failed to read config file: %v", err)
+	}
+	before := data.settings()
+	data.StrictCategories = strict
+	if err := s.writeConfigFile(s.configPath, data); err != nil {
+		return err
+	}
+	s.recordAudit(newAuditEntry("update_strict_categories", configEntityID, before, data.settings()))
+	return nil
+}
+
+func (s *jsonStore) UpdateUngroupedCurrencies(currencies []string) error {
+	currencies, err := validateUngroupedCurrencies(currencies)
+	if err != nil {
+		return err
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	data, err := s.readConfigFile(s.configPath)
+	if err != nil {
+		return fmt.Errorf("failed to read config file: %v", err)
+	}
+	before := data.settings()
+	data.UngroupedCurrencies = currencies
+	if err := s.writeConfigFile(s.configPath, data); err != nil {
+		return err
+	}
+	s.recordAudit(newAuditEntry("update_ungrouped_currencies", configEntityID, before, data.settings()))
+	return nil
+}
+
+func (s *jsonStore) UpdateNumberLocale(locale string) error {
+	locale, err := validateNumberLocale(locale)
+	if err != nil {
+		return err
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	data, err := s.readConfigFile(s.configPath)
+	if err != nil {
+		return fmt.Errorf("failed to read config file: %v", err)
+	}
+	before := data.settings()
+	data.NumberLocale = locale
+	if err := s.writeConfigFile(s.configPath, data); err != nil {
+		return err
+	}
+	s.recordAudit(newAuditEntry("update_number_locale", configEntityID, before, data.settings()))
+	return nil
+}
+
+func (s *jsonStore) UpdateSeparators(thousands, decimal string) error {
+	if err := validateSeparators(thousands, decimal); err != nil {
+		return err
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	data, err := s.readConfigFile(s.configPath)
+	if err != nil {
+		return fmt.Errorf("failed to read config file: %v", err)
+	}
+	before := data.settings()
+	data.ThousandsSeparator = thousands
+	data.DecimalSeparator = decimal
+	if err := s.writeConfigFile(s.configPath, data); err != nil {
+		return err
+	}
+	s.recordAudit(newAuditEntry("update_separators", configEntityID, before, data.settings()))
+	return nil
 }
 
 func (s *jsonStore) GetRecurringExpenses() ([]RecurringExpense, error) {
@@ -215,7 +672,7 @@ func (s *jsonStore) GetRecurringExpense(id string) (RecurringExpense, error) {
 			return r, nil
 		}
 	}
-	return RecurringExpense{}, fmt.Errorf("recurring expense with ID %s not found", id)
+	return RecurringExpense{}, fmt.Errorf("recurring expense with ID %s %w", id, ErrNotFound)
 }
 
 func (s *jsonStore) AddRecurringExpense(recurringExpense RecurringExpense) error {
@@ -225,18 +682,23 @@ func (s *jsonStore) AddRecurringExpense(recurringExpense RecurringExpense) error
 	if err != nil {
 		return fmt.Errorf("failed to read config file: %v", err)
 	}
+	if err := config.CheckExpenseCategories(Expense{Category: recurringExpense.Category}); err != nil {
+		return err
+	}
 	if recurringExpense.ID == "" {
 		recurringExpense.ID = uuid.New().String()
 	}
-	if recurringExpense.Currency == "" {
-		recurringExpense.Currency = s.defaults["currency"]
-	}
+	recurringExpense.Currency = resolveCurrency(recurringExpense.Currency, s.configuredCurrency())
 	config.RecurringExpenses = append(config.RecurringExpenses, recurringExpense)
 	if err := s.writeConfigFile(s.configPath, config); err != nil {
 		return fmt.Errorf("failed to write config file: %v", err)
 	}
-	expensesToAdd := generateExpensesFromRecurring(recurringExpense, false)
-	return s.AddMultipleExpenses(expensesToAdd)
+	expensesToAdd := generateExpensesFromRecurring(recurringExpense, time.Time{}, config.Holidays)
+	if _, err := s.appendExpenses(expensesToAdd); err != nil {
+		return err
+	}
+	s.recordAudit(newAuditEntry("add_recurring_expense", recurringExpense.ID, nil, recurringExpense))
+	return nil
 }
 
 func (s *jsonStore) RemoveRecurringExpense(id string, removeAll bool) error {
@@ -247,16 +709,18 @@ func (s *jsonStore) RemoveRecurringExpense(id string, removeAll bool) error {
 		return fmt.Errorf("failed to read config file: %v", err)
 	}
 	var found bool
+	var removed RecurringExpense
 	var updatedRecurringExpenses []RecurringExpense
 	for _, r := range config.RecurringExpenses {
 		if r.ID == id {
 			found = true
+			removed = r
 		} else {
 			updatedRecurringExpenses = append(updatedRecurringExpenses, r)
 		}
 	}
 	if !found {
-		return fmt.Errorf("recurring expense with ID %s not found", id)
+		return fmt.Errorf("recurring expense with ID %s %w", id, ErrNotFound)
 	}
 	config.RecurringExpenses = updatedRecurringExpenses
 	expensesData, err := s.readExpensesFile(s.filePath)
@@ -264,13 +728,9 @@ func (s *jsonStore) RemoveRecurringExpense(id string, removeAll bool) error {
 		return fmt.Errorf("failed to read storage file: %v", err)
 	}
 	var updatedExpenses []Expense
-	today := time.Now()
+	cutoff := recurringCutoff(removeAll)
 	for _, exp := range expensesData.Expenses {
-		if exp.RecurringID != id {
-			updatedExpenses = append(updatedExpenses, exp)
-			continue
-		}
-		if !removeAll && !exp.Date.After(today) {
+		if exp.RecurringID != id || beforeCutoff(exp, cutoff) {
 			updatedExpenses = append(updatedExpenses, exp)
 		}
 	}
@@ -278,7 +738,11 @@ func (s *jsonStore) RemoveRecurringExpense(id string, removeAll bool) error {
 	if err := s.writeExpensesFile(s.filePath, expensesData); err != nil {
 		return err
 	}
-	return s.writeConfigFile(s.configPath, config)
+	if err := s.writeConfigFile(s.configPath, config); err != nil {
+		return err
+	}
+	s.recordAudit(newAuditEntry("remove_recurring_expense", id, removed, nil))
+	return nil
 }
 
 func (s *jsonStore) UpdateRecurringExpense(id string, recurringExpense RecurringExpense, updateAll bool) error {
@@ -288,43 +752,116 @@ func (s *jsonStore) UpdateRecurringExpense(id string, recurringExpense Recurring
 	if err != nil {
 		return fmt.Errorf("failed to read config file: %v", err)
 	}
+	if err := config.CheckExpenseCategories(Expense{Category: recurringExpense.Category}); err != nil {
+		return err
+	}
 	var found bool
+	var before RecurringExpense
 	for i, r := range config.RecurringExpenses {
 		if r.ID == id {
+			before = r
 			recurringExpense.ID = id // Ensure ID is preserved
-			if recurringExpense.Currency == "" {
-				recurringExpense.Currency = s.defaults["currency"]
-			}
+			// keep the currency the rule was created with rather than the current default
+			recurringExpense.Currency = resolveCurrency(recurringExpense.Currency, resolveCurrency(r.Currency, s.configuredCurrency()))
 			config.RecurringExpenses[i] = recurringExpense
 			found = true
 			break
 		}
 	}
 	if !found {
-		return fmt.Errorf("recurring expense with ID %s not found", id)
+		return fmt.Errorf("recurring expense with ID %s %w", id, ErrNotFound)
 	}
 	expensesData, err := s.readExpensesFile(s.filePath)
 	if err != nil {
 		return fmt.Errorf("failed to read storage file: %v", err)
 	}
+	// instances before the cutoff are kept and those from it onwards are
+	// regenerated, so both steps must share the same cutoff
+	cutoff := recurringCutoff(updateAll)
 	var remainingExpenses []Expense
-	today := time.Now()
 	for _, exp := range expensesData.Expenses {
-		if exp.RecurringID != id {
+		if exp.RecurringID != id || beforeCutoff(exp, cutoff) {
 			remainingExpenses = append(remainingExpenses, exp)
+		}
+	}
+	expensesData.Expenses = remainingExpenses
+	expensesToAdd := generateExpensesFromRecurring(recurringExpense, cutoff, config.Holidays)
+	expensesData.Expenses = append(expensesData.Expenses, expensesToAdd...)
+	if err := s.writeExpensesFile(s.filePath, expensesData); err != nil {
+		return err
+	}
+	if err := s.writeConfigFile(s.configPath, config); err != nil {
+		return err
+	}
+	s.recordAudit(newAuditEntry("update_recurring_expense", id, before, recurringExpense))
+	return nil
+}
+
+func (s *jsonStore) GetRecurringExpensesDue(asOf time.Time) ([]RecurringExpense, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	config, err := s.readConfigFile(s.configPath)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read config file: %v", err)
+	}
+	expensesData, err := s.readExpensesFile(s.filePath)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read storage file: %v", err)
+	}
+	generated := make(map[string]int)
+	latest := make(map[string]time.Time)
+	for _, exp := range expensesData.Expenses {
+		if exp.RecurringID == "" {
 			continue
 		}
-		if !updateAll && !exp.Date.After(today) {
+		generated[exp.RecurringID]++
+		if exp.Date.After(latest[exp.RecurringID]) {
+			latest[exp.RecurringID] = exp.Date
+		}
+	}
+	var due []RecurringExpense
+	for _, r := range config.RecurringExpenses {
+		if isRecurringDue(r, generated[r.ID], latest[r.ID], asOf, config.Holidays) {
+			due = append(due, r)
+		}
+	}
+	return due, nil
+}
+
+func (s *jsonStore) RegenerateRecurringExpenses() (map[string]int, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	config, err := s.readConfigFile(s.configPath)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read config file: %v", err)
+	}
+	expensesData, err := s.readExpensesFile(s.filePath)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read storage file: %v", err)
+	}
+	cutoff := recurringCutoff(false)
+	ruleIDs := make(map[string]bool, len(config.RecurringExpenses))
+	for _, r := range config.RecurringExpenses {
+		ruleIDs[r.ID] = true
+	}
+	var remainingExpenses []Expense
+	for _, exp := range expensesData.Expenses {
+		if !ruleIDs[exp.RecurringID] || beforeCutoff(exp, cutoff) {
 			remainingExpenses = append(remainingExpenses, exp)
 		}
 	}
+	created := make(map[string]int, len(config.RecurringExpenses))
+	for _, r := range config.RecurringExpenses {
+		expensesToAdd := generateExpensesFromRecurring(r, cutoff, config.Holidays)
+		remainingExpenses = append(remainingExpenses, expensesToAdd...)
+		created[r.ID] = len(expensesToAdd)
+	}
 	expensesData.Expenses = remainingExpenses
-	expensesToAdd := generateExpensesFromRecurring(recurringExpense, !updateAll)
-	expensesData.Expenses = append(expensesData.Expenses, expensesToAdd...)
 	if err := s.writeExpensesFile(s.filePath, expensesData); err != nil {
-		return err
+		return nil, err
 	}
-	return s.writeConfigFile(s.configPath, config)
+	s.recordAudit(newAuditEntry("regenerate_recurring_expenses", "", nil, created))
+	return created, nil
 }
 
 // Expenses
@@ -339,6 +876,20 @@ func (s *jsonStore) GetAllExpenses() ([]Expense, error) {
 	return data.Expenses, nil
 }
 
+// the file is read whole anyway, so this only saves callers building a slice
+func (s *jsonStore) EachExpense(fn func(Expense) error) error {
+	expenses, err := s.GetAllExpenses()
+	if err != nil {
+		return err
+	}
+	for _, expense := range expenses {
+		if err := fn(expense); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
 func (s *jsonStore) GetExpense(id string) (Expense, error) {
 	s.mu.RLock()
 	defer s.mu.RUnlock()
@@ -352,28 +903,66 @@ func (s *jsonStore) GetExpense(id string) (Expense, error) {
 			return data.Expenses[i], nil
 		}
 	}
-	return Expense{}, fmt.Errorf("expense with ID %s not found", id)
+	return Expense{}, fmt.Errorf("expense with ID %s %w", id, ErrNotFound)
+}
+
+func (s *jsonStore) GetExpensesByIDs(ids []string) ([]Expense, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	data, err := s.readExpensesFile(s.filePath)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read storage file: %v", err)
+	}
+	wanted := make(map[string]struct{}, len(ids))
+	for _, id := range ids {
+		wanted[id] = struct{}{}
+	}
+	expenses := []Expense{}
+	for _, exp := range data.Expenses {
+		if _, found := wanted[exp.ID]; found {
+			expenses = append(expenses, exp)
+		}
+	}
+	return expenses, nil
+}
+
+func (s *jsonStore) GetExpensesByRecurringID(id string) ([]Expense, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	data, err := s.readExpensesFile(s.filePath)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read storage file: %v", err)
+	}
+	expenses := []Expense{}
+	for _, exp := range data.Expenses {
+		if exp.RecurringID == id {
+			expenses = append(expenses, exp)
+		}
+	}
+	slices.SortStableFunc(expenses, func(a, b Expense) int {
+		return a.Date.Compare(b.Date)
+	})
+	return expenses, nil
 }
 
 func (s *jsonStore) AddExpense(expense Expense) error {
 	s.mu.Lock()
 	defer s.mu.Unlock()
+	if err := s.checkCategories(expense); err != nil {
+		return err
+	}
 	data, err := s.readExpensesFile(s.filePath)
 	if err != nil {
 		return fmt.Errorf("failed to read storage file: %v", err)
 	}
-	if expense.ID == "" {
-		expense.ID = uuid.New().String()
-	}
-	if expense.Currency == "" {
-		expense.Currency = s.defaults["currency"]
-	}
-	if expense.Date.IsZero() {
-		expense.Date = time.Now()
-	}
+	s.setExpenseDefaults(&expense)
 	data.Expenses = append(data.Expenses, expense)
 	log.Printf("Added expense with ID %s\n", expense.ID)
-	return s.writeExpensesFile(s.filePath, data)
+	if err := s.writeExpensesFile(s.filePath, data); err != nil {
+		return err
+	}
+	s.recordAudit(newAuditEntry("add_expense", expense.ID, nil, expense))
+	return nil
 }
 
 func (s *jsonStore) RemoveExpense(id string) error {
@@ -384,34 +973,92 @@ func (s *jsonStore) RemoveExpense(id string) error {
 		return fmt.Errorf("failed to read storage file: %v", err)
 	}
 	found := false
+	var removed Expense
 	newExpenses := make([]Expense, 0, len(data.Expenses)-1)
 	for _, exp := range data.Expenses {
 		if exp.ID != id {
 			newExpenses = append(newExpenses, exp)
 		} else {
 			found = true
+			removed = exp
 		}
 	}
 	if !found {
 		log.Printf("Expense with ID %s not found\n", id)
-		return fmt.Errorf("expense with ID %s not found", id)
+		return fmt.Errorf("expense with ID %s %w", id, ErrNotFound)
 	}
 	log.Printf("Deleted expense with ID %s\n", id)
 	data.Expenses = newExpenses
-	return s.writeExpensesFile(s.filePath, data)
+	if err := s.writeExpensesFile(s.filePath, data); err != nil {
+		return err
+	}
+	s.recordAudit(newAuditEntry("remove_expense", id, removed, nil))
+	return nil
 }
 
 func (s *jsonStore) AddMultipleExpenses(expensesToAdd []Expense) error {
 	if len(expensesToAdd) == 0 {
 		return nil
 	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if err := s.checkCategories(expensesToAdd...); err != nil {
+		return err
+	}
+	added, err := s.appendExpenses(expensesToAdd)
+	if err != nil {
+		return err
+	}
+	s.recordAudit(newAuditEntry("add_expenses", "", nil, added))
+	return nil
+}
+
+// rejects expenses in categories missing from the config when strict
+// categories are on; callers must hold s.mu
+func (s *jsonStore) checkCategories(expenses ...Expense) error {
+	config, err := s.readConfigFile(s.configPath)
+	if err != nil {
+		return fmt.Errorf("failed to read config file: %v", err)
+	}
+	for _, expense := range expenses {
+		if err := config.CheckExpenseCategories(expense); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// fills in the ID, currency, and date when they are left empty, the same way
+// the Postgres store does on insert
+func (s *jsonStore) setExpenseDefaults(expense *Expense) {
+	if expense.ID == "" {
+		expense.ID = uuid.New().String()
+	}
+	expense.Currency = resolveCurrency(expense.Currency, s.configuredCurrency())
+	if expense.Date.IsZero() {
+		expense.Date = time.Now()
+	}
+}
+
+// returns the expenses as stored, with defaults filled in; callers must hold s.mu
+func (s *jsonStore) appendExpenses(expensesToAdd []Expense) ([]Expense, error) {
+	if len(expensesToAdd) == 0 {
+		return nil, nil
+	}
 	data, err := s.readExpensesFile(s.filePath)
 	if err != nil {
-		return fmt.Errorf("failed to read storage file: %v", err)
+		return nil, fmt.Errorf("failed to read storage file: %v", err)
+	}
+	added := slices.Clone(expensesToAdd)
+	for i := range added {
+		s.setExpenseDefaults(&added[i])
+	}
+	data.Expenses = append(data.Expenses, added...)
+	log.Printf("Added %d new expenses\n", len(added))
+	if err := s.writeExpensesFile(s.filePath, data); err != nil {
+		return nil, err
 	}
-	data.Expenses = append(data.Expenses, expensesToAdd...)
-	log.Printf("Added %d new recurring expense instances\n", len(expensesToAdd))
-	return s.writeExpensesFile(s.filePath, data)
+	return added, nil
 }
 
 func (s *jsonStore) RemoveMultipleExpenses(ids []string) error {
@@ -430,9 +1077,12 @@ func (s *jsonStore) RemoveMultipleExpenses(ids []string) error {
 	}
 	originalCount := len(data.Expenses)
 	newExpenses := make([]Expense, 0, originalCount)
+	var removed []Expense
 	for _, exp := range data.Expenses {
 		if _, found := idsToRemove[exp.ID]; !found {
 			newExpenses = append(newExpenses, exp)
+		} else {
+			removed = append(removed, exp)
 		}
 	}
 	if len(newExpenses) == originalCount {
@@ -441,32 +1091,141 @@ func (s *jsonStore) RemoveMultipleExpenses(ids []string) error {
 	}
 	log.Printf("Removed %d expenses\n", originalCount-len(newExpenses))
 	data.Expenses = newExpenses
-	return s.writeExpensesFile(s.filePath, data)
+	if err := s.writeExpensesFile(s.filePath, data); err != nil {
+		return err
+	}
+	s.recordAudit(newAuditEntry("remove_expenses", "", removed, nil))
+	return nil
 }
 
 func (s *jsonStore) UpdateExpense(id string, expense Expense) error {
+	_, err := s.updateExpense(id, func(stored *Expense) error {
+		*stored = expense
+		return nil
+	})
+	return err
+}
+
+func (s *jsonStore) PatchExpense(id string, apply func(*Expense) error) (Expense, error) {
+	return s.updateExpense(id, apply)
+}
+
+func (s *jsonStore) updateExpense(id string, apply func(*Expense) error) (Expense, error) {
 	s.mu.Lock()
 	defer s.mu.Unlock()
 	data, err := s.readExpensesFile(s.filePath)
 	if err != nil {
-		return fmt.Errorf("failed to read storage file: %v", err)
+		return Expense{}, fmt.Errorf("failed to read storage file: %v", err)
 	}
-	found := false
-	for i, exp := range data.Expenses {
-		if exp.ID == id {
-			data.Expenses[i] = expense
-			data.Expenses[i].ID = id
-			if data.Expenses[i].Currency == "" {
-				data.Expenses[i].Currency = s.defaults["currency"]
+	i := slices.IndexFunc(data.Expenses, func(exp Expense) bool { return exp.ID == id })
+	if i < 0 {
+		log.Printf("expense with ID %s not found\n", id)
+		return Expense{}, fmt.Errorf("expense with ID %s %w", id, ErrNotFound)
+	}
+	before := data.Expenses[i]
+	after := before
+	after.Tags = slices.Clone(before.Tags)
+	after.Splits = slices.Clone(before.Splits)
+	if err := apply(&after); err != nil {
+		return Expense{}, err
+	}
+	if err := s.checkCategories(after); err != nil {
+		return Expense{}, err
+	}
+	after.ID = id
+	after.Currency = resolveCurrency(after.Currency, s.configuredCurrency())
+	data.Expenses[i] = after
+	log.Printf("Edited expense with ID %s\n", id)
+	if err := s.writeExpensesFile(s.filePath, data); err != nil {
+		return Expense{}, err
+	}
+	s.recordAudit(newAuditEntry("update_expense", id, before, after))
+	return after, nil
+}
+
+// Audit Log
+
+func (s *jsonStore) GetAuditLog(limit, offset int) ([]AuditEntry, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	content, err := os.ReadFile(s.auditPath)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return []AuditEntry{}, nil
+		}
+		return nil, fmt.Errorf("failed to read audit log: %v", err)
+	}
+	lines := bytes.Split(bytes.TrimSpace(content), []byte("\n"))
+	entries := []AuditEntry{}
+	// the file is in chronological order, so walk it backwards
+	for i := len(lines) - 1 - offset; i >= 0 && len(entries) < limit; i-- {
+		if len(lines[i]) == 0 {
+			continue
+		}
+		var entry AuditEntry
+		if err := json.Unmarshal(lines[i], &entry); err != nil {
+			return nil, fmt.Errorf("failed to parse audit log line %d: %v", i+1, err)
+		}
+		entries = append(entries, entry)
+	}
+	return entries, nil
+}
+
+// size of the blocks GetAuditLogSince reads from the end of the audit log
+const auditReadBlock = 64 << 10
+
+// reads audit.jsonl backwards from the end until it reaches afterID, so polling
+// for new entries doesn't read the whole log each time
+func (s *jsonStore) GetAuditLogSince(afterID string, limit int) ([]AuditEntry, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	f, err := os.Open(s.auditPath)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return []AuditEntry{}, nil
+		}
+		return nil, fmt.Errorf("failed to open audit log: %v", err)
+	}
+	defer f.Close()
+	info, err := f.Stat()
+	if err != nil {
+		return nil, fmt.Errorf("failed to read audit log: %v", err)
+	}
+	offset := info.Size()
+	var pending []byte // read but not yet parsed, starting mid-line unless offset is 0
+	var newer []AuditEntry
+	for offset > 0 || len(pending) > 0 {
+		i := bytes.LastIndexByte(pending, '\n')
+		if i < 0 && offset > 0 {
+			block := min(offset, auditReadBlock)
+			offset -= block
+			chunk := make([]byte, block)
+			if _, err := f.ReadAt(chunk, offset); err != nil {
+				return nil, fmt.Errorf("failed to read audit log: %v", err)
 			}
-			found = true
+			pending = append(chunk, pending...)
+			continue
+		}
+		line := pending[i+1:]
+		pending = pending[:max(i, 0)]
+		if len(bytes.TrimSpace(line)) == 0 {
+			continue
+		}
+		var entry AuditEntry
+		if err := json.Unmarshal(line, &entry); err != nil {
+			return nil, fmt.Errorf("failed to parse audit log entry: %v", err)
+		}
+		if afterID != "" && entry.ID == afterID {
 			break
 		}
+		newer = append(newer, entry)
 	}
-	if !found {
-		log.Printf("expense with ID %s not found\n", id)
-		return fmt.Errorf("expense with ID %s not found", id)
+	slices.Reverse(newer)
+	if len(newer) > limit {
+		newer = newer[:limit]
 	}
-	log.Printf("Edited expense with ID %s\n", id)
-	return s.writeExpensesFile(s.filePath, data)
+	if newer == nil {
+		return []AuditEntry{}, nil
+	}
+	return newer, nil
 }
@@ -0,0 +1,424 @@
+package storage
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"slices"
+	"sync"
+	"testing"
+	"time"
+)
+
+func newTestJSONStore(t *testing.T) *jsonStore {
+	t.Helper()
+	store, err := InitializeJsonStore(SystemConfig{StorageURL: t.TempDir()})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return store
+}
+
+func TestRecurringCurrencySurvivesConfigChange(t *testing.T) {
+	store := newTestJSONStore(t)
+	rule := RecurringExpense{
+		Name:        "Rent",
+		Amount:      -100,
+		Category:    "Rent",
+		StartDate:   time.Now().AddDate(1, 0, 0), // future, so edits regenerate every instance
+		Interval:    "monthly",
+		Occurrences: 3,
+	}
+	if err := store.AddRecurringExpense(rule); err != nil {
+		t.Fatal(err)
+	}
+	rules, err := store.GetRecurringExpenses()
+	if err != nil || len(rules) != 1 {
+		t.Fatalf("got %d rules, err %v", len(rules), err)
+	}
+	id := rules[0].ID
+	if rules[0].Currency != "usd" {
+		t.Fatalf("rule created with currency %q, want usd", rules[0].Currency)
+	}
+
+	if err := store.UpdateCurrency("eur"); err != nil {
+		t.Fatal(err)
+	}
+	rule.Name = "Rent (edited)"
+	if err := store.UpdateRecurringExpense(id, rule, false); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := store.RegenerateRecurringExpenses(); err != nil {
+		t.Fatal(err)
+	}
+
+	edited, err := store.GetRecurringExpense(id)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if edited.Currency != "usd" {
+		t.Errorf("edited rule has currency %q, want usd", edited.Currency)
+	}
+	instances, err := store.GetExpensesByRecurringID(id)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(instances) != rule.Occurrences {
+		t.Fatalf("got %d instances, want %d", len(instances), rule.Occurrences)
+	}
+	for _, instance := range instances {
+		if instance.Name != rule.Name || instance.Currency != "usd" {
+			t.Errorf("instance %q on %s has currency %q, want %q in usd", instance.Name, instance.Date.Format(time.DateOnly), instance.Currency, rule.Name)
+		}
+	}
+}
+
+func TestPatchExpenseIsAtomic(t *testing.T) {
+	store := newTestJSONStore(t)
+	if err := store.AddExpense(Expense{ID: "a", Name: "Lunch", Category: "Food", Amount: -1, Date: time.Now()}); err != nil {
+		t.Fatal(err)
+	}
+	const patches = 50
+	var wg sync.WaitGroup
+	for range patches {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			if _, err := store.PatchExpense("a", func(e *Expense) error {
+				e.Amount--
+				return nil
+			}); err != nil {
+				t.Error(err)
+			}
+		}()
+	}
+	wg.Wait()
+	expense, err := store.GetExpense("a")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := float64(-1 - patches); expense.Amount != want {
+		t.Errorf("amount %v after %d concurrent patches, want %v", expense.Amount, patches, want)
+	}
+}
+
+func TestAddMultipleExpensesSetsDefaults(t *testing.T) {
+	store := newTestJSONStore(t)
+	if err := store.UpdateCurrency("eur"); err != nil {
+		t.Fatal(err)
+	}
+	date := time.Date(2025, time.May, 1, 0, 0, 0, 0, time.UTC)
+	if err := store.AddMultipleExpenses([]Expense{
+		{Name: "Bus", Category: "Travel", Amount: -2},
+		{ID: "kept", Name: "Hotel", Category: "Travel", Amount: -90, Currency: "gbp", Date: date},
+	}); err != nil {
+		t.Fatal(err)
+	}
+	expenses, err := store.GetAllExpenses()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(expenses) != 2 {
+		t.Fatalf("got %d expenses, want 2", len(expenses))
+	}
+	for _, expense := range expenses {
+		switch expense.Name {
+		case "Bus":
+			if expense.ID == "" || expense.Currency != "eur" || expense.Date.IsZero() {
+				t.Errorf("defaults not set: id %q, currency %q, date %s", expense.ID, expense.Currency, expense.Date)
+			}
+		case "Hotel":
+			if expense.ID != "kept" || expense.Currency != "gbp" || !expense.Date.Equal(date) {
+				t.Errorf("given values overwritten: id %q, currency %q, date %s", expense.ID, expense.Currency, expense.Date)
+			}
+		}
+	}
+}
+
+func TestWriteFileAtomicFailureKeepsOldFile(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "expenses.json")
+	if err := writeFileAtomic(path, []byte("old")); err != nil {
+		t.Fatal(err)
+	}
+	renameFile = func(string, string) error { return errors.New("disk full") }
+	t.Cleanup(func() { renameFile = os.Rename })
+
+	if err := writeFileAtomic(path, []byte("new")); err == nil {
+		t.Fatal("expected the write to fail")
+	}
+	content, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(content) != "old" {
+		t.Errorf("file holds %q after a failed write, want the old content", content)
+	}
+	entries, err := os.ReadDir(filepath.Dir(path))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(entries) != 1 {
+		t.Errorf("temp file left behind: %d entries in the directory", len(entries))
+	}
+}
+
+func TestInterruptedWriteLeavesStoreReadable(t *testing.T) {
+	store := newTestJSONStore(t)
+	if err := store.AddExpense(Expense{ID: "a", Name: "Lunch", Category: "Food", Amount: -12, Date: time.Now()}); err != nil {
+		t.Fatal(err)
+	}
+	// a crash mid-write leaves a truncated temp file next to the real one
+	partial := filepath.Join(store.dataDir, ".expenses.json.tmp-123")
+	if err := os.WriteFile(partial, []byte(`{"expenses":[{"id":"b","na`), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	reopened, err := InitializeJsonStore(SystemConfig{StorageURL: store.dataDir})
+	if err != nil {
+		t.Fatal(err)
+	}
+	expenses, err := reopened.GetAllExpenses()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(expenses) != 1 || expenses[0].ID != "a" {
+		t.Errorf("got %v after an interrupted write, want only expense a", expenses)
+	}
+}
+
+func TestGetAuditLogSince(t *testing.T) {
+	store := newTestJSONStore(t)
+	// enough entries to span several blocks read from the end of the file
+	for range 400 {
+		if err := store.AddExpense(Expense{Name: "Coffee", Category: "Food", Amount: -3, Date: time.Now()}); err != nil {
+			t.Fatal(err)
+		}
+	}
+	info, err := os.Stat(store.auditPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if info.Size() < 2*auditReadBlock {
+		t.Fatalf("audit log of %d bytes doesn't span several blocks", info.Size())
+	}
+	all, err := store.GetAuditLog(1000, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(all) != 400 {
+		t.Fatalf("got %d audit entries, want 400", len(all))
+	}
+	slices.Reverse(all) // oldest first, like GetAuditLogSince
+
+	tests := []struct {
+		name    string
+		afterID string
+		limit   int
+		want    []AuditEntry
+	}{
+		{name: "from the beginning", afterID: "", limit: 1000, want: all},
+		{name: "unknown ID starts from the beginning", afterID: "gone", limit: 10, want: all[:10]},
+		{name: "after an early entry", afterID: all[9].ID, limit: 1000, want: all[10:]},
+		{name: "limited to the oldest", afterID: all[9].ID, limit: 5, want: all[10:15]},
+		{name: "after the newest entry", afterID: all[399].ID, limit: 1000, want: []AuditEntry{}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := store.GetAuditLogSince(tt.afterID, tt.limit)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if len(got) != len(tt.want) {
+				t.Fatalf("got %d entries, want %d", len(got), len(tt.want))
+			}
+			for i := range got {
+				if got[i].ID != tt.want[i].ID {
+					t.Fatalf("entry %d is %s, want %s", i, got[i].ID, tt.want[i].ID)
+				}
+			}
+		})
+	}
+}
+
+// pins the recurring cutoff for the duration of a test
+func pinNow(t *testing.T, now time.Time) {
+	t.Helper()
+	timeNow = func() time.Time { return now }
+	t.Cleanup(func() { timeNow = time.Now })
+}
+
+func march(day, hour int) time.Time {
+	return time.Date(2026, time.March, day, hour, 0, 0, 0, time.UTC)
+}
+
+// adds a monthly rule with five instances and returns its ID and instances
+func addMonthlyRule(t *testing.T, store *jsonStore, start time.Time) (string, []Expense) {
+	t.Helper()
+	rule := RecurringExpense{Name: "Gym", Amount: -30, Currency: "usd", Category: "Healthcare", StartDate: start, Interval: "monthly", Occurrences: 5}
+	if err := store.AddRecurringExpense(rule); err != nil {
+		t.Fatal(err)
+	}
+	rules, err := store.GetRecurringExpenses()
+	if err != nil || len(rules) != 1 {
+		t.Fatalf("got %d rules, err %v", len(rules), err)
+	}
+	instances, err := store.GetExpensesByRecurringID(rules[0].ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return rules[0].ID, instances
+}
+
+func TestUpdateRecurringExpenseFutureOnly(t *testing.T) {
+	now := march(15, 12)
+	tests := []struct {
+		name      string
+		start     time.Time
+		updateAll bool
+		wantKept  int // oldest instances left exactly as they were
+	}{
+		{name: "past start, future only", start: march(15, 0).AddDate(0, -2, 0), wantKept: 3},
+		{name: "past start, all instances", start: march(15, 0).AddDate(0, -2, 0), updateAll: true, wantKept: 0},
+		{name: "instance on the cutoff is regenerated", start: now.AddDate(0, -2, 0), wantKept: 2},
+		{name: "future start, future only", start: march(20, 0), wantKept: 0},
+		{name: "future start, all instances", start: march(20, 0), updateAll: true, wantKept: 0},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			pinNow(t, now)
+			store := newTestJSONStore(t)
+			id, original := addMonthlyRule(t, store, tt.start)
+			edited := RecurringExpense{Name: "Gym (edited)", Amount: -35, Category: "Healthcare", StartDate: tt.start, Interval: "monthly", Occurrences: 5}
+			if err := store.UpdateRecurringExpense(id, edited, tt.updateAll); err != nil {
+				t.Fatal(err)
+			}
+			instances, err := store.GetExpensesByRecurringID(id)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if len(instances) != len(original) {
+				t.Fatalf("got %d instances, want %d", len(instances), len(original))
+			}
+			for i, instance := range instances {
+				if !instance.Date.Equal(original[i].Date) {
+					t.Errorf("instance %d dated %s, want %s", i, instance.Date, original[i].Date)
+				}
+				if i < tt.wantKept {
+					if instance.ID != original[i].ID || instance.Name != original[i].Name || instance.Amount != original[i].Amount {
+						t.Errorf("past instance %d changed: %+v, was %+v", i, instance, original[i])
+					}
+				} else if instance.Name != edited.Name || instance.Amount != edited.Amount {
+					t.Errorf("instance %d on %s not regenerated: %+v", i, instance.Date.Format(time.DateOnly), instance)
+				}
+			}
+		})
+	}
+}
+
+func TestRemoveRecurringExpenseSharesCutoff(t *testing.T) {
+	now := march(15, 12)
+	tests := []struct {
+		name      string
+		start     time.Time
+		removeAll bool
+		wantKept  int
+	}{
+		{name: "past start keeps past instances", start: march(15, 0).AddDate(0, -2, 0), wantKept: 3},
+		{name: "instance on the cutoff is removed", start: now.AddDate(0, -2, 0), wantKept: 2},
+		{name: "future start removes everything", start: march(20, 0), wantKept: 0},
+		{name: "remove all", start: march(15, 0).AddDate(0, -2, 0), removeAll: true, wantKept: 0},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			pinNow(t, now)
+			store := newTestJSONStore(t)
+			id, original := addMonthlyRule(t, store, tt.start)
+			if err := store.RemoveRecurringExpense(id, tt.removeAll); err != nil {
+				t.Fatal(err)
+			}
+			kept, err := store.GetExpensesByRecurringID(id)
+			if err != nil {
+				t.Fatal(err)
+			}
+			keptIDs := make([]string, len(kept))
+			for i, instance := range kept {
+				keptIDs[i] = instance.ID
+			}
+			wantIDs := make([]string, tt.wantKept)
+			for i := range wantIDs {
+				wantIDs[i] = original[i].ID
+			}
+			if !slices.Equal(keptIDs, wantIDs) {
+				t.Errorf("kept %v, want %v", keptIDs, wantIDs)
+			}
+		})
+	}
+}
+
+func TestStrictCategoriesOnEveryWrite(t *testing.T) {
+	store := newTestJSONStore(t)
+	if err := store.AddExpense(Expense{Name: "Lunch", Category: "Food", Amount: -12}); err != nil {
+		t.Fatal(err)
+	}
+	expenses, err := store.GetAllExpenses()
+	if err != nil || len(expenses) != 1 {
+		t.Fatalf("got %d expenses, err %v", len(expenses), err)
+	}
+	stored := expenses[0]
+	if err := store.UpdateStrictCategories(true); err != nil {
+		t.Fatal(err)
+	}
+	unknown := Expense{Name: "Lunch", Category: "Snacks", Amount: -12}
+	split := Expense{Name: "Lunch", Category: "Food", Amount: -12, Splits: []ExpenseSplit{{Category: "Snacks", Amount: -2}, {Category: "Food", Amount: -10}}}
+	rule := RecurringExpense{Name: "Gym", Amount: -30, Category: "Snacks", StartDate: time.Now(), Interval: "monthly", Occurrences: 2}
+	writes := []struct {
+		name  string
+		write func() error
+	}{
+		{"add", func() error { return store.AddExpense(unknown) }},
+		{"add split", func() error { return store.AddExpense(split) }},
+		{"add multiple", func() error { return store.AddMultipleExpenses([]Expense{unknown}) }},
+		{"update", func() error { return store.UpdateExpense(stored.ID, unknown) }},
+		{"patch", func() error {
+			_, err := store.PatchExpense(stored.ID, func(e *Expense) error {
+				e.Category = "Snacks"
+				return nil
+			})
+			return err
+		}},
+		{"add recurring", func() error { return store.AddRecurringExpense(rule) }},
+	}
+	for _, w := range writes {
+		if err := w.write(); !errors.Is(err, ErrInvalid) {
+			t.Errorf("%s: got %v, want ErrInvalid", w.name, err)
+		}
+	}
+	expenses, err = store.GetAllExpenses()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(expenses) != 1 || expenses[0].Category != "Food" {
+		t.Errorf("rejected writes changed the expenses: %+v", expenses)
+	}
+
+	// a rule added before strict categories were turned on can't be moved to
+	// an unconfigured category either
+	if err := store.UpdateStrictCategories(false); err != nil {
+		t.Fatal(err)
+	}
+	rule.Category = "Food"
+	if err := store.AddRecurringExpense(rule); err != nil {
+		t.Fatal(err)
+	}
+	rules, err := store.GetRecurringExpenses()
+	if err != nil || len(rules) != 1 {
+		t.Fatalf("got %d rules, err %v", len(rules), err)
+	}
+	if err := store.UpdateStrictCategories(true); err != nil {
+		t.Fatal(err)
+	}
+	rule.Category = "Snacks"
+	if err := store.UpdateRecurringExpense(rules[0].ID, rule, true); !errors.Is(err, ErrInvalid) {
+		t.Errorf("update recurring: got %v, want ErrInvalid", err)
+	}
+}
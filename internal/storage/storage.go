@@ -1,43 +1,106 @@
 package storage
 
 import (
+	"encoding/json"
+	"errors"
 	"fmt"
+	"hash/fnv"
+	"log"
+	"maps"
+	"math"
 	"os"
 	"regexp"
+	"slices"
+	"strconv"
 	"strings"
 	"time"
+
+	"github.com/google/uuid"
+	"golang.org/x/text/language"
 )
 
+// ErrNotFound is wrapped by errors for expenses, recurring expenses and
+// categories that don't exist
+var ErrNotFound = errors.New("not found")
+
+// ErrInvalid is matched by errors the caller can fix by changing the request,
+// such as an empty category name or one that is already taken
+var ErrInvalid = errors.New("invalid request")
+
+// keeps its own message while matching ErrInvalid
+type invalidError string
+
+func (e invalidError) Error() string        { return string(e) }
+func (e invalidError) Is(target error) bool { return target == ErrInvalid }
+
+func invalidf(format string, args ...any) error {
+	return invalidError(fmt.Sprintf(format, args...))
+}
+
 // Storage interface for all storage types
 type Storage interface {
 	Close() error
+	Status() (StorageStatus, error) // errors if the backend is unusable
+	Counts() (StorageCounts, error)
 	GetConfig() (*Config, error)
 
 	// Basic Config Updates
 	GetCategories() ([]string, error)
+	GetUsedCategories() ([]string, error) // distinct categories of stored expenses, sorted
 	UpdateCategories(categories []string) error
+	AddCategory(name string) error                       // no-op if it already exists
+	RemoveCategory(name string) error                    // no-op if it doesn't exist
+	GetCategoryColors() (map[string]string, error)       // every configured category, defaults included
+	UpdateCategoryColors(colors map[string]string) error // replaces the explicit colors
+	RenameCategory(oldName, newName string) error
+	MergeCategories(sources []string, target string) error
 	// GetTags() ([]string, error)
 	// UpdateTags(tags []string) error
 	GetCurrency() (string, error)
 	UpdateCurrency(currency string) error
 	GetStartDate() (int, error)
 	UpdateStartDate(startDate int) error
+	UpdateSymbolPosition(position string) error
+	UpdateHolidays(holidays []string) error // YYYY-MM-DD dates skipped by opted-in recurring rules
+	UpdateUngroupedCurrencies(currencies []string) error
+	UpdateStrictCategories(strict bool) error
+	UpdateNumberLocale(locale string) error           // empty to follow the currency
+	UpdateSeparators(thousands, decimal string) error // both empty to follow the locale
 
 	// Recurring Expenses
 	GetRecurringExpenses() ([]RecurringExpense, error)
 	GetRecurringExpense(id string) (RecurringExpense, error)
 	AddRecurringExpense(recurringExpense RecurringExpense) error
+	// removeAll deletes every instance; otherwise instances dated before now are
+	// kept, using the same cutoff as UpdateRecurringExpense
 	RemoveRecurringExpense(id string, removeAll bool) error
+	// updateAll regenerates every instance; otherwise instances dated before now
+	// are kept as-is and the rest are regenerated (all of them if the rule starts
+	// in the future)
 	UpdateRecurringExpense(id string, recurringExpense RecurringExpense, updateAll bool) error
+	GetRecurringExpensesDue(asOf time.Time) ([]RecurringExpense, error)
+	RegenerateRecurringExpenses() (map[string]int, error) // instances created per rule ID
 
 	// Expenses
 	GetAllExpenses() ([]Expense, error)
+	EachExpense(fn func(Expense) error) error // calls fn per expense in GetAllExpenses order, stopping at its first error
 	GetExpense(id string) (Expense, error)
+	GetExpensesByIDs(ids []string) ([]Expense, error)      // ids that don't exist are skipped
+	GetExpensesByRecurringID(id string) ([]Expense, error) // instances of a recurring rule, oldest first
 	AddExpense(expense Expense) error
 	RemoveExpense(id string) error
 	AddMultipleExpenses(expenses []Expense) error
 	RemoveMultipleExpenses(ids []string) error
 	UpdateExpense(id string, expense Expense) error
+	// calls apply on the stored expense and saves the result in one step, so no
+	// other write lands in between; an error from apply is returned unchanged
+	PatchExpense(id string, apply func(*Expense) error) (Expense, error)
+
+	// Audit Log
+	GetAuditLog(limit, offset int) ([]AuditEntry, error) // newest first
+	// up to limit entries recorded after the one with afterID, oldest first;
+	// starts from the beginning if afterID is empty or no longer in the log
+	GetAuditLogSince(afterID string, limit int) ([]AuditEntry, error)
 
 	// Potential Future Feature: Multi-currency
 	// GetConversions() (map[string]float64, error)
@@ -46,23 +109,33 @@ type Storage interface {
 
 // config for expense data
 type Config struct {
-	Categories        []string           `json:"categories"`
-	Currency          string             `json:"currency"`
-	StartDate         int                `json:"startDate"`
-	RecurringExpenses []RecurringExpense `json:"recurringExpenses"`
+	Categories          []string           `json:"categories"`
+	Currency            string             `json:"currency"`
+	StartDate           int                `json:"startDate"`
+	SymbolPosition      string             `json:"symbolPosition,omitempty"`      // default, left, or right of the amount
+	CategoryColors      map[string]string  `json:"categoryColors,omitempty"`      // explicit colors, others use defaultCategoryColor
+	Holidays            []string           `json:"holidays,omitempty"`            // sorted YYYY-MM-DD dates
+	UngroupedCurrencies []string           `json:"ungroupedCurrencies,omitempty"` // currencies shown without thousands grouping
+	StrictCategories    bool               `json:"strictCategories,omitempty"`    // reject expenses in categories not listed above
+	NumberLocale        string             `json:"numberLocale,omitempty"`        // BCP 47 tag for digit grouping and decimal marks, else the currency's
+	ThousandsSeparator  string             `json:"thousandsSeparator,omitempty"`  // overrides the locale's grouping mark when set
+	DecimalSeparator    string             `json:"decimalSeparator,omitempty"`    // overrides the locale's decimal mark when set
+	RecurringExpenses   []RecurringExpense `json:"recurringExpenses"`
 	// Tags              []string           `json:"tags"`
 }
 
 type RecurringExpense struct {
-	ID          string    `json:"id"`
-	Name        string    `json:"name"`
-	Amount      float64   `json:"amount"`
-	Currency    string    `json:"currency"`
-	Tags        []string  `json:"tags"`
-	Category    string    `json:"category"`
-	StartDate   time.Time `json:"startDate"`   // date of the first occurrence
-	Interval    string    `json:"interval"`    // daily, weekly, monthly, yearly
-	Occurrences int       `json:"occurrences"` // 0 for 3000 occurrences (heuristic)
+	ID           string    `json:"id"`
+	Name         string    `json:"name"`
+	Amount       float64   `json:"amount"`
+	Currency     string    `json:"currency"`
+	Tags         []string  `json:"tags"`
+	Category     string    `json:"category"`
+	StartDate    time.Time `json:"startDate"`              // date of the first occurrence
+	Interval     string    `json:"interval"`               // daily, weekly, monthly, yearly
+	Occurrences  int       `json:"occurrences"`            // 0 for 3000 occurrences (heuristic)
+	SkipWeekends bool      `json:"skipWeekends,omitempty"` // daily rules only: leave out Saturdays and Sundays
+	SkipHolidays bool      `json:"skipHolidays,omitempty"` // leave out the configured holidays
 }
 
 type BackendType string
@@ -74,29 +147,277 @@ const (
 
 // config for the storage backend
 type SystemConfig struct {
-	StorageURL  string
-	StorageType BackendType
-	StorageUser string
-	StoragePass string
-	StorageSSL  string
+	StorageURL         string
+	StorageType        BackendType
+	StorageUser        string
+	StoragePass        string
+	StorageSSL         string
+	StorageSSLRootCert string // CA certificate for verify-ca and verify-full
+	StorageSSLCert     string // client certificate
+	StorageSSLKey      string // client private key
+	MaxAmount          float64
+	MaxOccurrences     int
+}
+
+// backend details reported by the health check
+type StorageStatus struct {
+	Backend  BackendType `json:"backend"`
+	DataPath string      `json:"dataPath,omitempty"` // absolute data directory of the JSON backend
+}
+
+// number of stored rows, without loading them
+type StorageCounts struct {
+	Expenses          int
+	RecurringExpenses int
 }
 
 // expense struct
 type Expense struct {
-	ID          string    `json:"id"`
-	RecurringID string    `json:"recurringID"`
-	Name        string    `json:"name"`
-	Tags        []string  `json:"tags"`
-	Category    string    `json:"category"`
-	Amount      float64   `json:"amount"`
-	Currency    string    `json:"currency"`
-	Date        time.Time `json:"date"`
+	ID          string         `json:"id"`
+	RecurringID string         `json:"recurringID"`
+	Name        string         `json:"name"`
+	Tags        []string       `json:"tags"`
+	Category    string         `json:"category"`
+	Amount      float64        `json:"amount"`
+	Currency    string         `json:"currency"`
+	Date        time.Time      `json:"date"`
+	Splits      []ExpenseSplit `json:"splits,omitempty"` // optional per-category portions of the amount
+}
+
+// portion of an expense attributed to a category
+type ExpenseSplit struct {
+	Category string  `json:"category"`
+	Amount   float64 `json:"amount"`
+}
+
+// record of a single mutation, diff is {"before": ..., "after": ...} with
+// either side null for additions and removals
+type AuditEntry struct {
+	ID        string          `json:"id"`
+	Timestamp time.Time       `json:"timestamp"`
+	Operation string          `json:"operation"`
+	EntityID  string          `json:"entityId"`
+	Diff      json.RawMessage `json:"diff"`
+}
+
+// entity ID used for audit entries of config changes
+const configEntityID = "config"
+
+func newAuditEntry(operation, entityID string, before, after any) AuditEntry {
+	diff, err := json.Marshal(struct {
+		Before any `json:"before"`
+		After  any `json:"after"`
+	}{before, after})
+	if err != nil {
+		log.Printf("Failed to marshal audit diff for %s %s: %v\n", operation, entityID, err)
+		diff = []byte("null")
+	}
+	return AuditEntry{
+		ID:        uuid.New().String(),
+		Timestamp: time.Now(),
+		Operation: operation,
+		EntityID:  entityID,
+		Diff:      diff,
+	}
+}
+
+// the user editable part of the config, recorded in audit diffs
+type configSettings struct {
+	Categories     []string          `json:"categories"`
+	Currency       string            `json:"currency"`
+	StartDate      int               `json:"startDate"`
+	SymbolPosition string            `json:"symbolPosition,omitempty"`
+	CategoryColors map[string]string `json:"categoryColors,omitempty"`
+	Holidays       []string          `json:"holidays,omitempty"`
+	Ungrouped      []string          `json:"ungroupedCurrencies,omitempty"`
+	Strict         bool              `json:"strictCategories,omitempty"`
+	NumberLocale   string            `json:"numberLocale,omitempty"`
+	Thousands      string            `json:"thousandsSeparator,omitempty"`
+	Decimal        string            `json:"decimalSeparator,omitempty"`
+}
+
+func (c *Config) settings() configSettings {
+	return configSettings{
+		Categories:     slices.Clone(c.Categories),
+		Currency:       c.Currency,
+		StartDate:      c.StartDate,
+		SymbolPosition: c.SymbolPosition,
+		CategoryColors: maps.Clone(c.CategoryColors),
+		Holidays:       slices.Clone(c.Holidays),
+		Ungrouped:      slices.Clone(c.UngroupedCurrencies),
+		Strict:         c.StrictCategories,
+		NumberLocale:   c.NumberLocale,
+		Thousands:      c.ThousandsSeparator,
+		Decimal:        c.DecimalSeparator,
+	}
+}
+
+// deep copy, so callers can modify the result freely
+func (c *Config) clone() *Config {
+	clone := *c
+	clone.Categories = slices.Clone(c.Categories)
+	clone.CategoryColors = maps.Clone(c.CategoryColors)
+	clone.Holidays = slices.Clone(c.Holidays)
+	clone.UngroupedCurrencies = slices.Clone(c.UngroupedCurrencies)
+	clone.RecurringExpenses = slices.Clone(c.RecurringExpenses)
+	for i := range clone.RecurringExpenses {
+		clone.RecurringExpenses[i].Tags = slices.Clone(c.RecurringExpenses[i].Tags)
+	}
+	return &clone
+}
+
+func (c configSettings) equal(other configSettings) bool {
+	return slices.Equal(c.Categories, other.Categories) && c.Currency == other.Currency &&
+		c.StartDate == other.StartDate && c.SymbolPosition == other.SymbolPosition &&
+		maps.Equal(c.CategoryColors, other.CategoryColors) && slices.Equal(c.Holidays, other.Holidays) &&
+		slices.Equal(c.Ungrouped, other.Ungrouped) && c.Strict == other.Strict &&
+		c.NumberLocale == other.NumberLocale && c.Thousands == other.Thousands && c.Decimal == other.Decimal
+}
+
+// same palette the frontend uses for charts
+var categoryPalette = []string{
+	"#FF6B6B", "#4ECDC4", "#45B7D1", "#96CEB4",
+	"#FFBE0B", "#FF006E", "#8338EC", "#3A86FF",
+	"#FB5607", "#38B000", "#9B5DE5", "#F15BB5",
+}
+
+var RECategoryColor = regexp.MustCompile(`^#[0-9a-fA-F]{6}$`)
+
+// picks a palette color from the category name, so it stays the same
+// regardless of the order categories are listed in
+func defaultCategoryColor(category string) string {
+	h := fnv.New32a()
+	h.Write([]byte(category))
+	return categoryPalette[h.Sum32()%uint32(len(categoryPalette))]
+}
+
+// returns the explicit color of a category, or its default
+func (c *Config) CategoryColor(category string) string {
+	if color, ok := c.CategoryColors[category]; ok {
+		return color
+	}
+	return defaultCategoryColor(category)
+}
+
+// returns the colors of all configured categories
+func (c *Config) resolvedCategoryColors() map[string]string {
+	colors := make(map[string]string, len(c.Categories))
+	for _, category := range c.Categories {
+		colors[category] = c.CategoryColor(category)
+	}
+	return colors
+}
+
+// gives target the color of the first colored source unless it has its own,
+// and drops the sources' colors
+func (c *Config) reassignCategoryColors(sources []string, target string) {
+	for _, source := range sources {
+		if color, ok := c.CategoryColors[source]; ok && source != target {
+			if _, exists := c.CategoryColors[target]; !exists {
+				c.CategoryColors[target] = color
+			}
+			delete(c.CategoryColors, source)
+		}
+	}
+}
+
+// checks that colors are #rrggbb hex strings and normalizes them to upper case
+func validateCategoryColors(colors map[string]string) (map[string]string, error) {
+	normalized := make(map[string]string, len(colors))
+	for category, color := range colors {
+		if !RECategoryColor.MatchString(color) {
+			return nil, fmt.Errorf("invalid color for category %s: %s (expected #rrggbb)", category, color)
+		}
+		normalized[category] = strings.ToUpper(color)
+	}
+	return normalized, nil
+}
+
+// checks that every holiday is a YYYY-MM-DD date, returning them sorted
+// without duplicates
+func validateHolidays(holidays []string) ([]string, error) {
+	normalized := make([]string, 0, len(holidays))
+	for _, holiday := range holidays {
+		date, err := time.Parse(time.DateOnly, strings.TrimSpace(holiday))
+		if err != nil {
+			return nil, fmt.Errorf("invalid holiday: %s (expected YYYY-MM-DD)", holiday)
+		}
+		normalized = append(normalized, date.Format(time.DateOnly))
+	}
+	slices.Sort(normalized)
+	return slices.Compact(normalized), nil
+}
+
+// in strict mode, checks that the expense and its splits only use configured
+// categories, listing the valid ones in the error
+func (c *Config) CheckExpenseCategories(e Expense) error {
+	if !c.StrictCategories {
+		return nil
+	}
+	for _, part := range append([]ExpenseSplit{{Category: e.Category}}, e.Splits...) {
+		if !slices.Contains(c.Categories, part.Category) {
+			return invalidf("category '%s' is not configured, valid categories are: %s", part.Category, strings.Join(c.Categories, ", "))
+		}
+	}
+	return nil
+}
+
+// checks that every currency is supported, returning them sorted without
+// duplicates
+func validateUngroupedCurrencies(currencies []string) ([]string, error) {
+	for _, currency := range currencies {
+		if !slices.Contains(SupportedCurrencies, currency) {
+			return nil, fmt.Errorf("invalid currency: %s", currency)
+		}
+	}
+	sorted := slices.Clone(currencies)
+	slices.Sort(sorted)
+	return slices.Compact(sorted), nil
+}
+
+// checks that the locale is a well-formed BCP 47 tag, eg. ms-MY or en-IN, and
+// returns it in canonical form; the browser resolves it, falling back to its
+// closest supported locale
+func validateNumberLocale(locale string) (string, error) {
+	locale = strings.TrimSpace(locale)
+	if locale == "" {
+		return "", nil
+	}
+	tag, err := language.Parse(locale)
+	if err != nil {
+		return "", fmt.Errorf("invalid number locale: %s (expected a tag like ms-MY)", locale)
+	}
+	return tag.String(), nil
+}
+
+// marks that can stand in for the thousands or decimal separator
+var allowedSeparators = []string{",", ".", " ", "'", "\u00a0", "\u202f"}
+
+// checks that the separators are either both empty or both set, to allowed
+// marks that differ from each other so amounts stay unambiguous
+func validateSeparators(thousands, decimal string) error {
+	if thousands == "" && decimal == "" {
+		return nil
+	}
+	if thousands == "" || decimal == "" {
+		return invalidf("thousands and decimal separators must be set together")
+	}
+	for _, separator := range []string{thousands, decimal} {
+		if !slices.Contains(allowedSeparators, separator) {
+			return invalidf("invalid separator: %q", separator)
+		}
+	}
+	if thousands == decimal {
+		return invalidf("thousands and decimal separators must differ")
+	}
+	return nil
 }
 
 func (c *Config) SetBaseConfig() {
 	c.Categories = defaultCategories
-	c.Currency = "usd"
+	c.Currency = defaultCurrency
 	c.StartDate = 1
+	c.SymbolPosition = "default"
 	// c.Tags = []string{}
 	c.RecurringExpenses = []RecurringExpense{}
 }
@@ -107,6 +428,11 @@ func (c *SystemConfig) SetStorageConfig() {
 	c.StorageSSL = backendSSLFromEnv(os.Getenv("STORAGE_SSL"))
 	c.StorageUser = os.Getenv("STORAGE_USER")
 	c.StoragePass = os.Getenv("STORAGE_PASS")
+	c.StorageSSLRootCert = os.Getenv("STORAGE_SSL_ROOT_CERT")
+	c.StorageSSLCert = os.Getenv("STORAGE_SSL_CERT")
+	c.StorageSSLKey = os.Getenv("STORAGE_SSL_KEY")
+	c.MaxAmount = maxAmountFromEnv(os.Getenv("MAX_AMOUNT"))
+	c.MaxOccurrences = maxOccurrencesFromEnv(os.Getenv("MAX_OCCURRENCES"))
 }
 
 func backendTypeFromEnv(env string) BackendType {
@@ -127,6 +453,45 @@ func backendURLFromEnv(env string) string {
 	return env
 }
 
+// largest amount the NUMERIC(15, 3) amount columns can hold
+const amountColumnLimit = 999999999999.999
+
+// limit on the magnitude of amounts, checked by Validate before storing
+var maxAmount float64 = amountColumnLimit
+
+func maxAmountFromEnv(env string) float64 {
+	value, err := strconv.ParseFloat(env, 64)
+	if err != nil || value <= 0 || value > amountColumnLimit {
+		return amountColumnLimit
+	}
+	return value
+}
+
+func validateAmount(amount float64) error {
+	if math.IsNaN(amount) || math.IsInf(amount, 0) {
+		return fmt.Errorf("amount must be a finite number")
+	}
+	if math.Abs(amount) > maxAmount {
+		return fmt.Errorf("amount exceeds maximum of %.2f", maxAmount)
+	}
+	return nil
+}
+
+// default limit on how many instances a recurring expense may generate
+const defaultMaxOccurrences = 1000
+
+// checked by RecurringExpense.Validate, so a mistyped count can't flood the
+// store with generated expenses
+var maxOccurrences = defaultMaxOccurrences
+
+func maxOccurrencesFromEnv(env string) int {
+	value, err := strconv.Atoi(env)
+	if err != nil || value < 2 {
+		return defaultMaxOccurrences
+	}
+	return value
+}
+
 func backendSSLFromEnv(env string) string {
 	switch env {
 	case "disable", "require", "verify-full", "verify-ca":
@@ -136,10 +501,44 @@ func backendSSLFromEnv(env string) string {
 	}
 }
 
+// currency used when neither the expense nor the config specify one
+const defaultCurrency = "usd"
+
+// returns currency if set, else the configured currency, and only then usd
+// replaced in tests to pin the recurring cutoff
+var timeNow = time.Now
+
+// returns the instant that splits a rule's instances into past ones, dated
+// before it and kept, and future ones, dated on or after it and replaced or
+// removed; the zero time when every instance is affected
+func recurringCutoff(all bool) time.Time {
+	if all {
+		return time.Time{}
+	}
+	return timeNow()
+}
+
+// reports whether an instance is kept when changing a rule from cutoff on
+func beforeCutoff(expense Expense, cutoff time.Time) bool {
+	return expense.Date.Before(cutoff)
+}
+
+func resolveCurrency(currency, configured string) string {
+	if currency != "" {
+		return currency
+	}
+	if configured != "" {
+		return configured
+	}
+	return defaultCurrency
+}
+
 // initializes the storage backend
 func InitializeStorage() (Storage, error) {
 	baseConfig := SystemConfig{}
 	baseConfig.SetStorageConfig()
+	maxAmount = baseConfig.MaxAmount
+	maxOccurrences = baseConfig.MaxOccurrences
 	switch baseConfig.StorageType {
 	case BackendTypeJSON:
 		return InitializeJsonStore(baseConfig)
@@ -162,22 +561,69 @@ func SanitizeString(s string) string {
 func ValidateCategory(category string) (string, error) {
 	sanitized := SanitizeString(category)
 	if sanitized == "" {
-		return "", fmt.Errorf("category name cannot be empty or contain only invalid characters")
+		return "", invalidf("category name cannot be empty or contain only invalid characters")
 	}
 	return sanitized, nil
 }
 
+// returns the category list with the sources folded into target, which takes
+// the place of the first source if it is not already configured
+func mergeCategoryList(categories []string, sources []string, target string) ([]string, error) {
+	sources = slices.DeleteFunc(slices.Clone(sources), func(c string) bool { return c == target })
+	if len(sources) == 0 {
+		return nil, invalidf("at least one category other than the target is required to merge")
+	}
+	for _, source := range sources {
+		if !slices.Contains(categories, source) {
+			return nil, fmt.Errorf("category %s %w", source, ErrNotFound)
+		}
+	}
+	hasTarget := slices.Contains(categories, target)
+	var merged []string
+	for _, category := range categories {
+		if !slices.Contains(sources, category) {
+			merged = append(merged, category)
+		} else if !hasTarget {
+			merged = append(merged, target)
+			hasTarget = true
+		}
+	}
+	return merged, nil
+}
+
+// moves the expense and its splits from any of the source categories to
+// target, reporting whether anything changed
+func (e *Expense) reassignCategory(sources []string, target string) bool {
+	changed := false
+	if slices.Contains(sources, e.Category) {
+		e.Category = target
+		changed = true
+	}
+	for i := range e.Splits {
+		if slices.Contains(sources, e.Splits[i].Category) {
+			e.Splits[i].Category = target
+			changed = true
+		}
+	}
+	return changed
+}
+
 func (e *Expense) Validate() error {
 	e.Name = SanitizeString(e.Name)
 	if e.Name == "" {
 		return fmt.Errorf("expense 'name' cannot be empty")
 	}
+	// sanitized like configured categories, so strict categories can match them
+	e.Category = SanitizeString(e.Category)
 	if e.Category == "" {
 		return fmt.Errorf("expense 'category' cannot be empty")
 	}
 	if e.Amount == 0 {
 		return fmt.Errorf("expense 'amount' cannot be 0")
 	}
+	if err := validateAmount(e.Amount); err != nil {
+		return fmt.Errorf("expense %v", err)
+	}
 	// if e.Currency == "" {
 	// 	return fmt.Errorf("expense 'currency' cannot be empty")
 	// }
@@ -194,6 +640,31 @@ func (e *Expense) Validate() error {
 	if e.Date.IsZero() {
 		return fmt.Errorf("expense 'date' cannot be empty")
 	}
+	if len(e.Splits) > 0 {
+		if err := e.validateSplits(); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// splits must carry the sign of the expense and add up to its amount (to the cent)
+func (e *Expense) validateSplits() error {
+	var total float64
+	for i := range e.Splits {
+		e.Splits[i].Category = SanitizeString(e.Splits[i].Category)
+		if e.Splits[i].Category == "" {
+			return fmt.Errorf("expense split 'category' cannot be empty")
+		}
+		if e.Splits[i].Amount == 0 || (e.Splits[i].Amount < 0) != (e.Amount < 0) {
+			return fmt.Errorf("expense split amounts must be non-zero and have the same sign as the expense")
+		}
+		total += e.Splits[i].Amount
+	}
+	// compared at the three decimals amounts are stored with
+	if math.Round(total*1000) != math.Round(e.Amount*1000) {
+		return fmt.Errorf("expense splits add up to %g, expected %g", math.Round(total*1000)/1000, e.Amount)
+	}
 	return nil
 }
 
@@ -205,6 +676,9 @@ func (e *RecurringExpense) Validate() error {
 	if e.Category == "" {
 		return fmt.Errorf("recurring expense 'category' cannot be empty")
 	}
+	if err := validateAmount(e.Amount); err != nil {
+		return fmt.Errorf("recurring expense %v", err)
+	}
 	if len(e.Tags) > 0 {
 		var cleanedTags []string
 		for _, tag := range e.Tags {
@@ -218,6 +692,9 @@ func (e *RecurringExpense) Validate() error {
 	if e.Occurrences < 2 {
 		return fmt.Errorf("at least 2 occurences required to recur")
 	}
+	if e.Occurrences > maxOccurrences {
+		return fmt.Errorf("occurrences exceed maximum of %d", maxOccurrences)
+	}
 	if e.StartDate.IsZero() {
 		return fmt.Errorf("start date for recurring expense must be specified")
 	}
@@ -247,35 +724,79 @@ var defaultCategories = []string{
 	"Income",
 }
 
+// "default" keeps each currency's own symbol placement
+var SymbolPositions = []string{"default", "left", "right"}
+
 var SupportedCurrencies = []string{
-	"usd", // US Dollar
-	"eur", // Euro
-	"gbp", // British Pound
-	"jpy", // Japanese Yen
-	"cny", // Chinese Yuan
-	"krw", // Korean Won
-	"inr", // Indian Rupee
-	"rub", // Russian Ruble
-	"brl", // Brazilian Real
-	"zar", // South African Rand
-	"aed", // UAE Dirham
-	"aud", // Australian Dollar
-	"cad", // Canadian Dollar
-	"chf", // Swiss Franc
-	"hkd", // Hong Kong Dollar
-	"bdt", // Bangladeshi Taka
-	"sgd", // Singapore Dollar
-	"thb", // Thai Baht
-	"try", // Turkish Lira
-	"mxn", // Mexican Peso
-	"php", // Philippine Peso
-	"pln", // Polish Złoty
-	"sek", // Swedish Krona
-	"nzd", // New Zealand Dollar
-	"dkk", // Danish Krone
-	"idr", // Indonesian Rupiah
-	"ils", // Israeli New Shekel
-	"vnd", // Vietnamese Dong
-	"myr", // Malaysian Ringgit
-	"mad", // Moroccan Dirham
+	"usd",
+	"eur",
+	"gbp",
+	"jpy",
+	"cny",
+	"krw",
+	"inr",
+	"rub",
+	"brl",
+	"zar",
+	"aed",
+	"aud",
+	"cad",
+	"chf",
+	"hkd",
+	"bdt",
+	"sgd",
+	"thb",
+	"try",
+	"mxn",
+	"php",
+	"pln",
+	"sek",
+	"nzd",
+	"dkk",
+	"idr",
+	"ils",
+	"vnd",
+	"myr",
+	"mad",
+}
+
+var currencyNames = map[string]string{
+	"usd": "US Dollar",
+	"eur": "Euro",
+	"gbp": "British Pound",
+	"jpy": "Japanese Yen",
+	"cny": "Chinese Yuan",
+	"krw": "Korean Won",
+	"inr": "Indian Rupee",
+	"rub": "Russian Ruble",
+	"brl": "Brazilian Real",
+	"zar": "South African Rand",
+	"aed": "UAE Dirham",
+	"aud": "Australian Dollar",
+	"cad": "Canadian Dollar",
+	"chf": "Swiss Franc",
+	"hkd": "Hong Kong Dollar",
+	"bdt": "Bangladeshi Taka",
+	"sgd": "Singapore Dollar",
+	"thb": "Thai Baht",
+	"try": "Turkish Lira",
+	"mxn": "Mexican Peso",
+	"php": "Philippine Peso",
+	"pln": "Polish Złoty",
+	"sek": "Swedish Krona",
+	"nzd": "New Zealand Dollar",
+	"dkk": "Danish Krone",
+	"idr": "Indonesian Rupiah",
+	"ils": "Israeli New Shekel",
+	"vnd": "Vietnamese Dong",
+	"myr": "Malaysian Ringgit",
+	"mad": "Moroccan Dirham",
+}
+
+// returns the display name of a supported currency, or the code itself
+func CurrencyName(code string) string {
+	if name, ok := currencyNames[code]; ok {
+		return name
+	}
+	return code
 }
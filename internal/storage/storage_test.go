@@ -0,0 +1,78 @@
+package storage
+
+import (
+	"errors"
+	"testing"
+	"time"
+)
+
+func TestValidateNumberLocale(t *testing.T) {
+	tests := []struct {
+		locale  string
+		want    string
+		wantErr bool
+	}{
+		{locale: "", want: ""},
+		{locale: " ms-MY ", want: "ms-MY"},
+		{locale: "en-in", want: "en-IN"},
+		{locale: "de-CH-1996", want: "de-CH-1996"},
+		{locale: "en-12", wantErr: true},
+		{locale: "en-US-ab", wantErr: true},
+		{locale: "english", wantErr: true},
+	}
+	for _, tt := range tests {
+		got, err := validateNumberLocale(tt.locale)
+		if (err != nil) != tt.wantErr || got != tt.want {
+			t.Errorf("validateNumberLocale(%q) = %q, %v; want %q, error %v", tt.locale, got, err, tt.want, tt.wantErr)
+		}
+	}
+}
+
+func TestValidateSeparators(t *testing.T) {
+	tests := []struct {
+		thousands, decimal string
+		wantErr            bool
+	}{
+		{thousands: "", decimal: ""},
+		{thousands: ".", decimal: ","},
+		{thousands: "\u202f", decimal: ","},
+		{thousands: ",", decimal: ",", wantErr: true},
+		{thousands: ".", decimal: "", wantErr: true},
+		{thousands: "", decimal: ",", wantErr: true},
+		{thousands: "1", decimal: ".", wantErr: true},
+		{thousands: ",,", decimal: ".", wantErr: true},
+	}
+	for _, tt := range tests {
+		err := validateSeparators(tt.thousands, tt.decimal)
+		if (err != nil) != tt.wantErr {
+			t.Errorf("validateSeparators(%q, %q) = %v, want error %v", tt.thousands, tt.decimal, err, tt.wantErr)
+		}
+		if err != nil && !errors.Is(err, ErrInvalid) {
+			t.Errorf("validateSeparators(%q, %q) = %v, want ErrInvalid", tt.thousands, tt.decimal, err)
+		}
+	}
+}
+
+func TestValidateSanitizesSplitCategories(t *testing.T) {
+	tests := []struct {
+		category string
+		want     string
+		wantErr  bool
+	}{
+		{category: " Groceries ", want: "Groceries"},
+		{category: "Home  <b>Goods</b>", want: "Home b Goods b"},
+		{category: "<>", wantErr: true},
+	}
+	for _, tt := range tests {
+		expense := Expense{Name: "Market", Category: "Groceries", Amount: -10, Date: time.Now(),
+			Splits: []ExpenseSplit{{Category: "Groceries", Amount: -6}, {Category: tt.category, Amount: -4}}}
+		err := expense.Validate()
+		if (err != nil) != tt.wantErr {
+			t.Errorf("split category %q: got error %v, want error %v", tt.category, err, tt.wantErr)
+			continue
+		}
+		if err == nil && expense.Splits[1].Category != tt.want {
+			t.Errorf("split category %q stored as %q, want %q", tt.category, expense.Splits[1].Category, tt.want)
+		}
+	}
+}
@@ -0,0 +1,245 @@
+package storage
+
+import "time"
+
+// timedStore reports how long every call to the wrapped store takes
+type timedStore struct {
+	store   Storage
+	observe func(operation string, duration time.Duration)
+}
+
+// WithQueryTimer wraps s so observe is called with the method name and
+// duration of every storage call, which for Postgres covers the queries the
+// call runs
+func WithQueryTimer(s Storage, observe func(operation string, duration time.Duration)) Storage {
+	return &timedStore{store: s, observe: observe}
+}
+
+func (t *timedStore) time(operation string) func() {
+	start := time.Now()
+	return func() { t.observe(operation, time.Since(start)) }
+}
+
+func (t *timedStore) Close() error {
+	defer t.time("Close")()
+	return t.store.Close()
+}
+
+func (t *timedStore) Status() (StorageStatus, error) {
+	defer t.time("Status")()
+	return t.store.Status()
+}
+
+func (t *timedStore) Counts() (StorageCounts, error) {
+	defer t.time("Counts")()
+	return t.store.Counts()
+}
+
+func (t *timedStore) GetConfig() (*Config, error) {
+	defer t.time("GetConfig")()
+	return t.store.GetConfig()
+}
+
+func (t *timedStore) GetCategories() ([]string, error) {
+	defer t.time("GetCategories")()
+	return t.store.GetCategories()
+}
+
+func (t *timedStore) GetUsedCategories() ([]string, error) {
+	defer t.time("GetUsedCategories")()
+	return t.store.GetUsedCategories()
+}
+
+func (t *timedStore) UpdateCategories(categories []string) error {
+	defer t.time("UpdateCategories")()
+	return t.store.UpdateCategories(categories)
+}
+
+func (t *timedStore) AddCategory(name string) error {
+	defer t.time("AddCategory")()
+	return t.store.AddCategory(name)
+}
+
+func (t *timedStore) RemoveCategory(name string) error {
+	defer t.time("RemoveCategory")()
+	return t.store.RemoveCategory(name)
+}
+
+func (t *timedStore) GetCategoryColors() (map[string]string, error) {
+	defer t.time("GetCategoryColors")()
+	return t.store.GetCategoryColors()
+}
+
+func (t *timedStore) UpdateCategoryColors(colors map[string]string) error {
+	defer t.time("UpdateCategoryColors")()
+	return t.store.UpdateCategoryColors(colors)
+}
+
+func (t *timedStore) RenameCategory(oldName, newName string) error {
+	defer t.time("RenameCategory")()
+	return t.store.RenameCategory(oldName, newName)
+}
+
+func (t *timedStore) MergeCategories(sources []string, target string) error {
+	defer t.time("MergeCategories")()
+	return t.store.MergeCategories(sources, target)
+}
+
+func (t *timedStore) GetCurrency() (string, error) {
+	defer t.time("GetCurrency")()
+	return t.store.GetCurrency()
+}
+
+func (t *timedStore) UpdateCurrency(currency string) error {
+	defer t.time("UpdateCurrency")()
+	return t.store.UpdateCurrency(currency)
+}
+
+func (t *timedStore) GetStartDate() (int, error) {
+	defer t.time("GetStartDate")()
+	return t.store.GetStartDate()
+}
+
+func (t *timedStore) UpdateStartDate(startDate int) error {
+	defer t.time("UpdateStartDate")()
+	return t.store.UpdateStartDate(startDate)
+}
+
+func (t *timedStore) UpdateSymbolPosition(position string) error {
+	defer t.time("UpdateSymbolPosition")()
+	return t.store.UpdateSymbolPosition(position)
+}
+
+func (t *timedStore) UpdateHolidays(holidays []string) error {
+	defer t.time("UpdateHolidays")()
+	return t.store.UpdateHolidays(holidays)
+}
+
+func (t *timedStore) UpdateUngroupedCurrencies(currencies []string) error {
+	defer t.time("UpdateUngroupedCurrencies")()
+	return t.store.UpdateUngroupedCurrencies(currencies)
+}
+
+func (t *timedStore) UpdateStrictCategories(strict bool) error {
+	defer t.time("UpdateStrictCategories")()
+	return t.store.UpdateStrictCategories(strict)
+}
+
+func (t *timedStore) UpdateNumberLocale(locale string) error {
+	defer t.time("UpdateNumberLocale")()
+	return t.store.UpdateNumberLocale(locale)
+}
+
+func (t *timedStore) UpdateSeparators(thousands, decimal string) error {
+	defer t.time("UpdateSeparators")()
+	return t.store.UpdateSeparators(thousands, decimal)
+}
+
+func (t *timedStore) GetRecurringExpenses() ([]RecurringExpense, error) {
+	defer t.time("GetRecurringExpenses")()
+	return t.store.GetRecurringExpenses()
+}
+
+func (t *timedStore) GetRecurringExpense(id string) (RecurringExpense, error) {
+	defer t.time("GetRecurringExpense")()
+	return t.store.GetRecurringExpense(id)
+}
+
+func (t *timedStore) AddRecurringExpense(recurringExpense RecurringExpense) error {
+	defer t.time("AddRecurringExpense")()
+	return t.store.AddRecurringExpense(recurringExpense)
+}
+
+func (t *timedStore) RemoveRecurringExpense(id string, removeAll bool) error {
+	defer t.time("RemoveRecurringExpense")()
+	return t.store.RemoveRecurringExpense(id, removeAll)
+}
+
+func (t *timedStore) UpdateRecurringExpense(id string, recurringExpense RecurringExpense, updateAll bool) error {
+	defer t.time("UpdateRecurringExpense")()
+	return t.store.UpdateRecurringExpense(id, recurringExpense, updateAll)
+}
+
+func (t *timedStore) GetRecurringExpensesDue(asOf time.Time) ([]RecurringExpense, error) {
+	defer t.time("GetRecurringExpensesDue")()
+	return t.store.GetRecurringExpensesDue(asOf)
+}
+
+func (t *timedStore) RegenerateRecurringExpenses() (map[string]int, error) {
+	defer t.time("RegenerateRecurringExpenses")()
+	return t.store.RegenerateRecurringExpenses()
+}
+
+func (t *timedStore) GetAllExpenses() ([]Expense, error) {
+	defer t.time("GetAllExpenses")()
+	return t.store.GetAllExpenses()
+}
+
+// leaves out the time spent in fn, which for exports is mostly spent writing
+// to the client rather than reading from storage
+func (t *timedStore) EachExpense(fn func(Expense) error) error {
+	start := time.Now()
+	var inFn time.Duration
+	err := t.store.EachExpense(func(expense Expense) error {
+		called := time.Now()
+		defer func() { inFn += time.Since(called) }()
+		return fn(expense)
+	})
+	t.observe("EachExpense", time.Since(start)-inFn)
+	return err
+}
+
+func (t *timedStore) GetExpense(id string) (Expense, error) {
+	defer t.time("GetExpense")()
+	return t.store.GetExpense(id)
+}
+
+func (t *timedStore) GetExpensesByIDs(ids []string) ([]Expense, error) {
+	defer t.time("GetExpensesByIDs")()
+	return t.store.GetExpensesByIDs(ids)
+}
+
+func (t *timedStore) GetExpensesByRecurringID(id string) ([]Expense, error) {
+	defer t.time("GetExpensesByRecurringID")()
+	return t.store.GetExpensesByRecurringID(id)
+}
+
+func (t *timedStore) AddExpense(expense Expense) error {
+	defer t.time("AddExpense")()
+	return t.store.AddExpense(expense)
+}
+
+func (t *timedStore) RemoveExpense(id string) error {
+	defer t.time("RemoveExpense")()
+	return t.store.RemoveExpense(id)
+}
+
+func (t *timedStore) AddMultipleExpenses(expenses []Expense) error {
+	defer t.time("AddMultipleExpenses")()
+	return t.store.AddMultipleExpenses(expenses)
+}
+
+func (t *timedStore) RemoveMultipleExpenses(ids []string) error {
+	defer t.time("RemoveMultipleExpenses")()
+	return t.store.RemoveMultipleExpenses(ids)
+}
+
+func (t *timedStore) UpdateExpense(id string, expense Expense) error {
+	defer t.time("UpdateExpense")()
+	return t.store.UpdateExpense(id, expense)
+}
+
+func (t *timedStore) PatchExpense(id string, apply func(*Expense) error) (Expense, error) {
+	defer t.time("PatchExpense")()
+	return t.store.PatchExpense(id, apply)
+}
+
+func (t *timedStore) GetAuditLog(limit, offset int) ([]AuditEntry, error) {
+	defer t.time("GetAuditLog")()
+	return t.store.GetAuditLog(limit, offset)
+}
+
+func (t *timedStore) GetAuditLogSince(afterID string, limit int) ([]AuditEntry, error) {
+	defer t.time("GetAuditLogSince")()
+	return t.store.GetAuditLogSince(afterID, limit)
+}
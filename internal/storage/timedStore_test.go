@@ -0,0 +1,32 @@
+package storage
+
+import (
+	"testing"
+	"time"
+)
+
+func TestTimedEachExpenseExcludesCallback(t *testing.T) {
+	store := newTestJSONStore(t)
+	for range 3 {
+		if err := store.AddExpense(Expense{Name: "Lunch", Category: "Food", Amount: -12}); err != nil {
+			t.Fatal(err)
+		}
+	}
+	var observed time.Duration
+	timed := WithQueryTimer(store, func(operation string, duration time.Duration) {
+		if operation == "EachExpense" {
+			observed = duration
+		}
+	})
+	// a slow client reading an export
+	err := timed.EachExpense(func(Expense) error {
+		time.Sleep(50 * time.Millisecond)
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if observed <= 0 || observed >= 50*time.Millisecond {
+		t.Errorf("observed %s for EachExpense, want the storage time only", observed)
+	}
+}
@@ -44,14 +44,32 @@ function formatCurrency(amount) {
         useSpace: false,
         right: false,
     };
+    // the configured position, if any, overrides the currency's own placement
+    const right = symbolPosition === 'left' ? false : symbolPosition === 'right' ? true : behavior.right;
     const isNegative = amount < 0;
     const absAmount = Math.abs(amount);
     const options = {
         minimumFractionDigits: behavior.useDecimals ? 2 : 0,
         maximumFractionDigits: behavior.useDecimals ? 2 : 0,
+        useGrouping: !ungroupedCurrencies.includes(currentCurrency),
     };
-    let formattedAmount = new Intl.NumberFormat(behavior.useComma ? "de-DE" : "en-US",options).format(absAmount);
-    let result = behavior.right
+    // a configured number locale overrides the currency's own separators
+    const currencyLocale = behavior.useComma ? "de-DE" : "en-US";
+    let formatter;
+    try {
+        formatter = new Intl.NumberFormat(numberLocale || currencyLocale, options);
+    } catch (error) {
+        // a tag this browser can't handle shouldn't break every amount on the page
+        if (!(error instanceof RangeError)) throw error;
+        formatter = new Intl.NumberFormat(currencyLocale, options);
+    }
+    // configured separators take precedence over the locale's marks
+    let formattedAmount = thousandsSeparator && decimalSeparator
+        ? formatter.formatToParts(absAmount).map(part =>
+            part.type === 'group' ? thousandsSeparator : part.type === 'decimal' ? decimalSeparator : part.value
+        ).join('')
+        : formatter.format(absAmount);
+    let result = right
         ? `${formattedAmount}${behavior.useSpace ? " " : ""}${behavior.symbol}`
         : `${behavior.symbol}${behavior.useSpace ? " " : ""}${formattedAmount}`;
     return isNegative ? `-${result}` : result;
@@ -98,48 +116,38 @@ function updateMonthDisplay() {
     }
 }
 
+// returns the period containing date as a half-open range [start, end), where
+// end is the start of the next period, so boundary expenses are counted once
 function getMonthBounds(date) {
     const localDate = new Date(date);
-    if (startDate === 1) {
-        const startLocal = new Date(localDate.getFullYear(), localDate.getMonth(), 1);
-        const endLocal = new Date(localDate.getFullYear(), localDate.getMonth() + 1, 0, 23, 59, 59, 999);
-        return { start: new Date(startLocal.toISOString()), end: new Date(endLocal.toISOString()) };
-    }
-    let thisMonthStartDate = startDate;
-    let prevMonthStartDate = startDate;
-
-    const currentMonth = localDate.getMonth();
-    const currentYear = localDate.getFullYear();
-    const daysInCurrentMonth = new Date(currentYear, currentMonth + 1, 0).getDate();
-    thisMonthStartDate = Math.min(thisMonthStartDate, daysInCurrentMonth);
-    const prevMonth = currentMonth === 0 ? 11 : currentMonth - 1;
-    const prevYear = currentMonth === 0 ? currentYear - 1 : currentYear;
-    const daysInPrevMonth = new Date(prevYear, prevMonth + 1, 0).getDate();
-    prevMonthStartDate = Math.min(prevMonthStartDate, daysInPrevMonth);
-
-    if (localDate.getDate() < thisMonthStartDate) {
-        const startLocal = new Date(prevYear, prevMonth, prevMonthStartDate);
-        const endLocal = new Date(currentYear, currentMonth, thisMonthStartDate - 1, 23, 59, 59, 999);
-        return { start: new Date(startLocal.toISOString()), end: new Date(endLocal.toISOString()) };
-    } else {
-        const nextMonth = currentMonth === 11 ? 0 : currentMonth + 1;
-        const nextYear = currentMonth === 11 ? currentYear + 1 : currentYear;
-        const daysInNextMonth = new Date(nextYear, nextMonth + 1, 0).getDate();
-        let nextMonthStartDate = Math.min(startDate, daysInNextMonth);
-        const startLocal = new Date(currentYear, currentMonth, thisMonthStartDate);
-        const endLocal = new Date(nextYear, nextMonth, nextMonthStartDate - 1, 23, 59, 59, 999);
-        return { start: new Date(startLocal.toISOString()), end: new Date(endLocal.toISOString()) };
+    const periodStart = (year, month) => {
+        const daysInMonth = new Date(year, month + 1, 0).getDate();
+        return new Date(year, month, Math.min(startDate, daysInMonth));
+    };
+    const year = localDate.getFullYear();
+    let month = localDate.getMonth();
+    if (localDate < periodStart(year, month)) {
+        month -= 1;
     }
+    return { start: periodStart(year, month), end: periodStart(year, month + 1) };
 }
 
 function getMonthExpenses(expenses) {
     const { start, end } = getMonthBounds(currentDate);
     return expenses.filter(exp => {
         const expDate = new Date(exp.date);
-        return expDate >= start && expDate <= end;
+        return expDate >= start && expDate < end;
     }).sort((a, b) => new Date(b.date) - new Date(a.date));
 }
 
+// returns the per-category portions of an expense, honoring splits if present
+function getExpenseParts(exp) {
+    if (Array.isArray(exp.splits) && exp.splits.length > 0) {
+        return exp.splits;
+    }
+    return [{ category: exp.category, amount: exp.amount }];
+}
+
 function escapeHTML(str) {
     if (typeof str !== 'string') return str;
     return str.replace(/[&<>'"]/g,